@@ -3,6 +3,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
@@ -12,12 +13,16 @@ type Config struct {
 	Upload   UploadConfig
 	JWT      JWTConfig
 	S3       S3Config       // ← добавили
+	Storage  StorageConfig
+	Jobs     JobsConfig
+	Janitor  JanitorConfig
 }
 
 type ServerConfig struct {
 	Port           string
 	MaxBodySize    int
 	AllowedOrigins string
+	AdminEmails    string // comma-separated; these users may call /api/admin/*
 }
 
 type DatabaseConfig struct {
@@ -31,9 +36,35 @@ type DatabaseConfig struct {
 
 type UploadConfig struct {
 	Directory      string
+	StagingDir     string // in-flight chunks are spooled here, not kept in RAM
 	ChunkSize      int
+	MaxChunkSize   int // largest REST chunk accepted; each is read into memory once
 	MaxRetries     int
 	VerifyInterval int
+	ExpiryHours    int // unfinished uploads stop being resumable after this much inactivity
+	DefaultQuota   int64 // bytes per user unless overridden on the user; 0 = unlimited
+}
+
+// StorageConfig picks where finished files are kept.
+type StorageConfig struct {
+	Backend string // "local", "s3" or "memory"
+}
+
+// JobsConfig tunes the background job queue (S3 uploads etc.)
+type JobsConfig struct {
+	Workers          int // parallel workers per process
+	PollSeconds      int // how often idle workers look for due jobs
+	RetryBaseSeconds int // first retry delay; doubles on every attempt
+	LeaseSeconds     int // a running job not heartbeated for this long is re-queued
+	TimeoutSeconds   int // a single run is cancelled after this long; 0 = no limit
+}
+
+// JanitorConfig controls the periodic cleanup of abandoned uploads. Uploads
+// go stale after UploadConfig.ExpiryHours without activity.
+type JanitorConfig struct {
+	IntervalMinutes    int // how often the janitor runs; 0 disables it
+	RetentionHours     int // failed and expired uploads are deleted after this long
+	TrashRetentionDays int // trashed files and folders are deleted for good after this long; 0 = keep forever
 }
 
 type JWTConfig struct {
@@ -47,17 +78,34 @@ type S3Config struct {
 	AccessKeyID     string // AKIA...
 	SecretAccessKey string // wJal...
 	Bucket          string // driveclone-files
+	PartSizeMB      int    // multipart part size; S3 requires at least 5
+	PartConcurrency int    // parts uploaded in parallel per process
+
+	// S3-compatible servers (MinIO, Ceph, LocalStack). Empty Endpoint = AWS.
+	Endpoint           string // URL the server talks to, e.g. http://minio:9000
+	PublicEndpoint     string // URL put into presigned links; defaults to Endpoint
+	UsePathStyle       bool   // bucket in the path instead of the host name
+	InsecureSkipVerify bool   // accept self-signed TLS certificates
+
 	// Если true — файлы хранятся в S3.
 	// Если false — хранятся локально (для локальной разработки без AWS).
 	Enabled bool
 }
 
 func LoadConfig() *Config {
+	uploadDir := getEnv("UPLOAD_DIR", "./uploads")
+	s3Enabled := getEnv("AWS_ACCESS_KEY_ID", "") != "" && getEnv("AWS_S3_BUCKET", "") != ""
+	defaultBackend := "local"
+	if s3Enabled {
+		defaultBackend = "s3"
+	}
+
 	return &Config{
 		Server: ServerConfig{
 			Port:           getEnv("SERVER_PORT", "8080"),
 			MaxBodySize:    getEnvInt("MAX_BODY_SIZE", 100*1024*1024),
 			AllowedOrigins: getEnv("ALLOWED_ORIGINS", "*"),
+			AdminEmails:    getEnv("ADMIN_EMAILS", ""),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -68,10 +116,26 @@ func LoadConfig() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		Upload: UploadConfig{
-			Directory:      getEnv("UPLOAD_DIR", "./uploads"),
+			Directory:      uploadDir,
+			StagingDir:     getEnv("UPLOAD_STAGING_DIR", filepath.Join(uploadDir, ".staging")),
 			ChunkSize:      getEnvInt("CHUNK_SIZE", 1024*1024),
+			MaxChunkSize:   getEnvInt("MAX_CHUNK_SIZE", 8*1024*1024),
 			MaxRetries:     getEnvInt("MAX_RETRIES", 3),
 			VerifyInterval: getEnvInt("VERIFY_INTERVAL", 10),
+			ExpiryHours:    getEnvInt("UPLOAD_EXPIRY_HOURS", 24),
+			DefaultQuota:   int64(getEnvInt("DEFAULT_QUOTA_MB", 10*1024)) << 20,
+		},
+		Jobs: JobsConfig{
+			Workers:          getEnvInt("JOB_WORKERS", 4),
+			PollSeconds:      getEnvInt("JOB_POLL_SECONDS", 5),
+			RetryBaseSeconds: getEnvInt("JOB_RETRY_BASE_SECONDS", 10),
+			LeaseSeconds:     getEnvInt("JOB_LEASE_SECONDS", 120),
+			TimeoutSeconds:   getEnvInt("JOB_TIMEOUT_SECONDS", 3600),
+		},
+		Janitor: JanitorConfig{
+			IntervalMinutes:    getEnvInt("JANITOR_INTERVAL_MINUTES", 15),
+			RetentionHours:     getEnvInt("JANITOR_RETENTION_HOURS", 7*24),
+			TrashRetentionDays: getEnvInt("TRASH_RETENTION_DAYS", 30),
 		},
 		JWT: JWTConfig{
 			Secret:      getEnv("JWT_SECRET", "change-me-in-production"),
@@ -82,9 +146,20 @@ func LoadConfig() *Config {
 			AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
 			SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
 			Bucket:          getEnv("AWS_S3_BUCKET", ""),
+			PartSizeMB:      getEnvInt("S3_PART_SIZE_MB", 8),
+			PartConcurrency: getEnvInt("S3_PART_CONCURRENCY", 4),
+
+			Endpoint:           getEnv("S3_ENDPOINT", ""),
+			PublicEndpoint:     getEnv("S3_PUBLIC_ENDPOINT", getEnv("S3_ENDPOINT", "")),
+			UsePathStyle:       getEnvBool("S3_USE_PATH_STYLE", false),
+			InsecureSkipVerify: getEnvBool("S3_INSECURE_SKIP_VERIFY", false),
+
 			// S3 включается автоматически если все ключи заполнены
-			Enabled: getEnv("AWS_ACCESS_KEY_ID", "") != "" &&
-				getEnv("AWS_S3_BUCKET", "") != "",
+			Enabled: s3Enabled,
+		},
+		Storage: StorageConfig{
+			// Explicit STORAGE_BACKEND wins; otherwise S3 when configured
+			Backend: getEnv("STORAGE_BACKEND", defaultBackend),
 		},
 	}
 }
@@ -103,4 +178,13 @@ func getEnvInt(key string, fallback int) int {
 		}
 	}
 	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
 }
\ No newline at end of file
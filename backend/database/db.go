@@ -40,11 +40,27 @@ func (d *Database) Connect() error {
 
 	slog.Info("database connected", "host", d.cfg.Host, "name", d.cfg.Name)
 
+	// file_chunks is unique on (file_upload_id, chunk_index); drop the
+	// duplicates racing chunk requests could insert before the index existed
+	if d.db.Migrator().HasTable(&models.FileChunk{}) {
+		if err = d.db.Exec(`
+			DELETE FROM file_chunks a USING file_chunks b
+			WHERE a.file_upload_id = b.file_upload_id AND a.chunk_index = b.chunk_index AND a.id > b.id`,
+		).Error; err != nil {
+			return fmt.Errorf("dedupe file_chunks: %w", err)
+		}
+	}
+
 	if err = d.db.AutoMigrate(
 		&models.User{},
 		&models.Folder{},
 		&models.FileUpload{},
 		&models.FileChunk{},
+		&models.Job{},
+		&models.Blob{},
+		&models.ShareLink{},
+		&models.ShareAccess{},
+		&models.Grant{},
 	); err != nil {
 		return fmt.Errorf("auto migrate: %w", err)
 	}
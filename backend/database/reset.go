@@ -11,6 +11,11 @@ func (d *Database) DropAllTables() error {
 	slog.Warn("dropping all tables - data will be lost!")
 	
 	tables := []string{
+		"grants",
+		"share_accesses",
+		"share_links",
+		"jobs",
+		"blobs",
 		"file_chunks",
 		"file_uploads",
 		"folders",
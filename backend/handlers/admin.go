@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminHandler serves /api/admin/* — operator endpoints behind AdminOnly.
+type AdminHandler struct {
+	janitor types.IJanitor
+}
+
+func NewAdminHandler(janitor types.IJanitor) *AdminHandler {
+	return &AdminHandler{janitor: janitor}
+}
+
+// GetJanitor returns the report of the janitor's most recent run.
+func (h *AdminHandler) GetJanitor(c *fiber.Ctx) error {
+	last := h.janitor.LastRun()
+	if last == nil {
+		return utils.Respond(c, utils.NewError(fiber.StatusNotFound, "janitor has not run yet"))
+	}
+	return c.JSON(last)
+}
+
+// RunJanitor runs a cleanup right away and returns its report.
+func (h *AdminHandler) RunJanitor(c *fiber.Ctx) error {
+	return c.JSON(h.janitor.Run(c.Context()))
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"file-transfer-backend/middleware"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxArchiveFiles caps how many file ids one archive request may name.
+const maxArchiveFiles = 10000
+
+type ArchiveHandler struct {
+	archives types.IArchiveService
+	perms    types.IPermissionService
+}
+
+func NewArchiveHandler(archives types.IArchiveService, perms types.IPermissionService) *ArchiveHandler {
+	return &ArchiveHandler{archives: archives, perms: perms}
+}
+
+// ArchiveFolder streams a folder as <name>.zip; ?method=store|deflate. Viewers
+// of a shared folder get the same archive as its owner.
+func (h *ArchiveHandler) ArchiveFolder(c *fiber.Ctx) error {
+	id, err := parseUint(c.Params("id"))
+	if err != nil { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id")) }
+	method, err := archiveMethod(c.Query("method"))
+	if err != nil { return utils.Respond(c, err) }
+	folder, err := h.perms.Folder(middleware.UserIDFromToken(c), id, types.RoleViewer)
+	if err != nil { return utils.Respond(c, err) }
+	name, entries, err := h.archives.Folder(folder.UserID, id)
+	if err != nil { return utils.Respond(c, err) }
+	return streamArchive(c, h.archives, folder.UserID, name+".zip", entries, method)
+}
+
+// ArchiveFiles streams a selection of files: {"ids": [...], "method": "store"|"deflate"}.
+// Ids that are not the caller's, trashed or unfinished are left out — files
+// shared with the caller are downloaded one by one or through their folder.
+func (h *ArchiveHandler) ArchiveFiles(c *fiber.Ctx) error {
+	var req struct {
+		IDs    []uint `json:"ids"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid request body")) }
+	if len(req.IDs) == 0 { return utils.Respond(c, utils.NewFieldError(fiber.StatusBadRequest, "ids", "ids is required")) }
+	if len(req.IDs) > maxArchiveFiles {
+		return utils.Respond(c, utils.NewFieldError(fiber.StatusBadRequest, "ids", "too many files in one archive"))
+	}
+	method, err := archiveMethod(req.Method)
+	if err != nil { return utils.Respond(c, err) }
+	entries, err := h.archives.Files(middleware.UserIDFromToken(c), req.IDs)
+	if err != nil { return utils.Respond(c, err) }
+	return streamArchive(c, h.archives, middleware.UserIDFromToken(c), "files.zip", entries, method)
+}
+
+// streamArchive sends uid's archive as it is built. Headers go out before
+// the first byte is read from storage, so a failure midway can only cut the
+// response short — the client sees a truncated ZIP.
+func streamArchive(c *fiber.Ctx, archives types.IArchiveService, uid uint, name string, entries []types.ArchiveEntry, method uint16) error {
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, utils.ContentDisposition("attachment", name))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := archives.Write(context.Background(), w, entries, method); err != nil {
+			slog.Error("archive: stream aborted", "user", uid, "archive", name, "err", err)
+			return
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+func archiveMethod(v string) (uint16, error) {
+	switch v {
+	case "", "deflate":
+		return zip.Deflate, nil
+	case "store":
+		return zip.Store, nil
+	}
+	return 0, utils.NewFieldError(fiber.StatusBadRequest, "method", `method must be "store" or "deflate"`)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ─── Serving file bytes ───────────────────────────────────────────────────────
+//
+// Every download that goes through the server — local disk, memory, or S3
+// proxied — is served by serveFile, so all backends answer the same way:
+//
+//	- ETag is the SHA-256 checksum (strong); Last-Modified is the upload time
+//	- If-None-Match / If-Modified-Since → 304
+//	- Range → 206 with one range, multipart/byteranges with several, 416 when
+//	  nothing in it lies inside the file
+//	- If-Range that no longer matches → the whole file, 200
+//
+// Ranges are read from storage with IRangeReader when the backend has it, so
+// resuming a large download only moves the missing bytes.
+
+// ServeContent streams a file through the server on every backend, with
+// range and conditional request support. Used for resuming downloads and by
+// clients that can't follow a presigned URL.
+func (h *FileHandler) ServeContent(c *fiber.Ctx) error {
+	file, err := h.file(c, types.RoleViewer)
+	if err != nil { return utils.Respond(c, err) }
+	if err := downloadable(file); err != nil { return utils.Respond(c, err) }
+	return serveFile(c, h.store, file, nil)
+}
+
+// downloadable reports why a file's bytes can't be served yet, if they can't.
+func downloadable(file *models.FileUpload) error {
+	if file.Status == "processing" {
+		return utils.NewError(fiber.StatusConflict, "file is still uploading to cloud storage, try again shortly")
+	}
+	if file.FilePath == "" {
+		return utils.NewError(fiber.StatusNotFound, "file not found in storage")
+	}
+	return nil
+}
+
+// serveFile answers a download of file. When served is set it is told what
+// kind of response is about to go out — "download" (the whole file, or a
+// range from its first byte), "partial" or "not_modified" — and can still
+// refuse it with an error.
+func serveFile(c *fiber.Ctx, store types.IStorage, file *models.FileUpload, served func(outcome string) error) error {
+	if served == nil {
+		served = func(string) error { return nil }
+	}
+	info, err := store.Stat(c.Context(), file.FilePath)
+	if err != nil {
+		slog.Warn("download: object missing", "file_id", file.ID, "key", file.FilePath, "err", err)
+		return utils.Respond(c, utils.NewError(fiber.StatusNotFound, "file not found in storage"))
+	}
+	size     := info.Size
+	modified := file.CreatedAt.UTC().Truncate(time.Second)
+	etag     := ""
+	if file.Checksum != "" {
+		etag = `"` + file.Checksum + `"`
+		c.Set(fiber.HeaderETag, etag)
+	}
+	c.Set(fiber.HeaderLastModified, modified.Format(http.TimeFormat))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	c.Set(fiber.HeaderContentDisposition, utils.ContentDisposition("attachment", file.FileName))
+
+	if notModified(c, etag, modified) {
+		if err := served("not_modified"); err != nil {
+			return utils.Respond(c, err)
+		}
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	var ranges []utils.ByteRange
+	if rangeApplies(c, etag, modified) {
+		if ranges, err = utils.ParseRange(c.Get(fiber.HeaderRange), size); errors.Is(err, utils.ErrRangeNotSatisfiable) {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return utils.Respond(c, utils.NewError(fiber.StatusRequestedRangeNotSatisfiable, "requested range not satisfiable"))
+		}
+	}
+	ctype := file.FileType
+	if ctype == "" {
+		ctype = fiber.MIMEOctetStream
+	}
+	outcome := "download"
+	if len(ranges) > 0 && ranges[0].Start > 0 {
+		outcome = "partial"
+	}
+	if err := served(outcome); err != nil {
+		return utils.Respond(c, err)
+	}
+
+	switch len(ranges) {
+	case 0:
+		body, err := store.Get(c.Context(), file.FilePath)
+		if err != nil {
+			slog.Error("download: open failed", "file_id", file.ID, "key", file.FilePath, "err", err)
+			return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "failed to read file"))
+		}
+		slog.Info("download served", "file_id", file.ID, "file_name", file.FileName, "storage", store.Name())
+		c.Set(fiber.HeaderContentType, ctype)
+		return c.SendStream(body, int(size))
+
+	case 1:
+		r := ranges[0]
+		body, err := openRange(c.Context(), store, file.FilePath, r)
+		if err != nil {
+			slog.Error("download: open failed", "file_id", file.ID, "key", file.FilePath, "err", err)
+			return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "failed to read file"))
+		}
+		slog.Info("download range served", "file_id", file.ID, "range", r.ContentRange(size), "storage", store.Name())
+		c.Status(fiber.StatusPartialContent)
+		c.Set(fiber.HeaderContentType, ctype)
+		c.Set(fiber.HeaderContentRange, r.ContentRange(size))
+		return c.SendStream(body, int(r.Length))
+	}
+
+	// Several ranges: one multipart/byteranges body, each part read from
+	// storage in turn. Headers are out by then, so a storage failure midway
+	// can only cut the body short.
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	slog.Info("download ranges served", "file_id", file.ID, "ranges", len(ranges), "storage", store.Name())
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentType, "multipart/byteranges; boundary="+boundary)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		mw := multipart.NewWriter(w)
+		mw.SetBoundary(boundary)
+		for _, r := range ranges {
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				fiber.HeaderContentType:  {ctype},
+				fiber.HeaderContentRange: {r.ContentRange(size)},
+			})
+			if err == nil {
+				err = copyRange(context.Background(), store, file.FilePath, r, part)
+			}
+			if err != nil {
+				slog.Error("download: ranges aborted", "file_id", file.ID, "key", file.FilePath, "err", err)
+				return
+			}
+		}
+		mw.Close()
+		w.Flush()
+	})
+	return nil
+}
+
+// openRange opens r of the object at key. Backends without ranged reads are
+// read from the start and the bytes before r are dropped.
+func openRange(ctx context.Context, store types.IStorage, key string, r utils.ByteRange) (io.ReadCloser, error) {
+	if rr, ok := store.(types.IRangeReader); ok {
+		return rr.GetRange(ctx, key, r.Start, r.Length)
+	}
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, body, r.Start); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(body, r.Length), body}, nil
+}
+
+func copyRange(ctx context.Context, store types.IStorage, key string, r utils.ByteRange, w io.Writer) error {
+	body, err := openRange(ctx, store, key, r)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	n, err := io.Copy(w, body)
+	if err == nil && n != r.Length {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is no
+// If-None-Match (RFC 9110 §13.2.2). If-None-Match compares weakly.
+func notModified(c *fiber.Ctx, etag string, modified time.Time) bool {
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince))
+	return err == nil && !modified.After(since)
+}
+
+// rangeApplies evaluates If-Range: the Range header is honoured only while
+// the client's copy is still current. An entity tag must match strongly; a
+// date must equal Last-Modified exactly.
+func rangeApplies(c *fiber.Ctx, etag string, modified time.Time) bool {
+	ir := c.Get(fiber.HeaderIfRange)
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		return etag != "" && ir == etag
+	}
+	t, err := http.ParseTime(ir)
+	return err == nil && t.Equal(modified)
+}
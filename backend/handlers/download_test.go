@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"file-transfer-backend/models"
+	"file-transfer-backend/services"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestServeFile(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lastMod  := modified.Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		body    string
+		crange  string
+		outcome string // "" = served was not called
+	}{
+		{"whole file", nil, 200, "0123456789", "", "download"},
+		{"range", map[string]string{"Range": "bytes=2-4"}, 206, "234", "bytes 2-4/10", "partial"},
+		{"range from start", map[string]string{"Range": "bytes=0-4"}, 206, "01234", "bytes 0-4/10", "download"},
+		{"suffix range", map[string]string{"Range": "bytes=-3"}, 206, "789", "bytes 7-9/10", "partial"},
+		{"unparsable range", map[string]string{"Range": "bytes=x-y"}, 200, "0123456789", "", "download"},
+		{"unsatisfiable range", map[string]string{"Range": "bytes=20-"}, 416, "", "bytes */10", ""},
+
+		{"if-range etag matches", map[string]string{"Range": "bytes=2-4", "If-Range": `"abc"`}, 206, "234", "bytes 2-4/10", "partial"},
+		{"if-range etag changed", map[string]string{"Range": "bytes=2-4", "If-Range": `"old"`}, 200, "0123456789", "", "download"},
+		{"if-range weak etag", map[string]string{"Range": "bytes=2-4", "If-Range": `W/"abc"`}, 200, "0123456789", "", "download"},
+		{"if-range date matches", map[string]string{"Range": "bytes=2-4", "If-Range": lastMod}, 206, "234", "bytes 2-4/10", "partial"},
+		{"if-range date changed", map[string]string{"Range": "bytes=2-4", "If-Range": modified.Add(-time.Hour).Format(http.TimeFormat)}, 200, "0123456789", "", "download"},
+		{"if-range ignored when range unsatisfiable and stale", map[string]string{"Range": "bytes=20-", "If-Range": `"old"`}, 200, "0123456789", "", "download"},
+
+		{"if-none-match", map[string]string{"If-None-Match": `"abc"`}, 304, "", "", "not_modified"},
+		{"if-none-match weak", map[string]string{"If-None-Match": `"x", W/"abc"`}, 304, "", "", "not_modified"},
+		{"if-none-match star", map[string]string{"If-None-Match": "*"}, 304, "", "", "not_modified"},
+		{"if-none-match other", map[string]string{"If-None-Match": `"x"`}, 200, "0123456789", "", "download"},
+		{"if-modified-since current", map[string]string{"If-Modified-Since": lastMod}, 304, "", "", "not_modified"},
+		{"if-modified-since older", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, 200, "0123456789", "", "download"},
+		{"if-none-match wins over date", map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": lastMod}, 200, "0123456789", "", "download"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, outcome := serveApp(t, modified)
+			req := httptest.NewRequest(fiber.MethodGet, "/f", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d (%s)", resp.StatusCode, tt.status, body)
+			}
+			if tt.status != 416 && string(body) != tt.body {
+				t.Fatalf("body %q, want %q", body, tt.body)
+			}
+			if got := resp.Header.Get("Content-Range"); got != tt.crange {
+				t.Fatalf("Content-Range %q, want %q", got, tt.crange)
+			}
+			if *outcome != tt.outcome {
+				t.Fatalf("outcome %q, want %q", *outcome, tt.outcome)
+			}
+			if tt.status != 416 && resp.Header.Get("ETag") != `"abc"` {
+				t.Fatalf("ETag %q", resp.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestServeFileRanges(t *testing.T) {
+	app, outcome := serveApp(t, time.Now())
+	req := httptest.NewRequest(fiber.MethodGet, "/f", nil)
+	req.Header.Set("Range", "bytes=0-1,8-")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != 206 || err != nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "multipart/byteranges;") {
+		t.Fatalf("status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for _, want := range [][2]string{{"bytes 0-1/10", "01"}, {"bytes 8-9/10", "89"}} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		if part.Header.Get("Content-Range") != want[0] || string(body) != want[1] {
+			t.Fatalf("part %q %q, want %q %q", part.Header.Get("Content-Range"), body, want[0], want[1])
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("extra part: %v", err)
+	}
+	if *outcome != "download" {
+		t.Fatalf("outcome %q", *outcome)
+	}
+}
+
+// serveApp serves a 10-byte file from memory storage on GET /f and records
+// the outcome serveFile reports.
+func serveApp(t *testing.T, modified time.Time) (*fiber.App, *string) {
+	t.Helper()
+	store := services.NewMemoryStorage()
+	if err := store.Put(context.Background(), "k", strings.NewReader("0123456789"), 10, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	file := &models.FileUpload{ID: 1, FileName: "a.txt", FileType: "text/plain", FilePath: "k", Checksum: "abc", CreatedAt: modified}
+
+	outcome := new(string)
+	app := fiber.New()
+	app.Get("/f", func(c *fiber.Ctx) error {
+		return serveFile(c, store, file, func(o string) error {
+			*outcome = o
+			return nil
+		})
+	})
+	return app, outcome
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"file-transfer-backend/middleware"
 	"file-transfer-backend/models"
 	"file-transfer-backend/types"
@@ -12,13 +13,29 @@ import (
 )
 
 type FolderHandler struct {
-	repo types.IFolderRepository
+	repo   types.IFolderRepository
+	blobs  types.IBlobService
+	trash  types.ITrashService
+	copies types.ICopyService
+	perms  types.IPermissionService
 }
 
-func NewFolderHandler(repo types.IFolderRepository) types.IFolderHandler {
-	return &FolderHandler{repo: repo}
+func NewFolderHandler(repo types.IFolderRepository, blobs types.IBlobService, trash types.ITrashService, copies types.ICopyService, perms types.IPermissionService) types.IFolderHandler {
+	return &FolderHandler{repo: repo, blobs: blobs, trash: trash, copies: copies, perms: perms}
 }
 
+// folder loads the :id folder if the caller holds at least role need on it —
+// as its owner or through a grant on it or a folder above.
+func (h *FolderHandler) folder(c *fiber.Ctx, need types.Role) (*models.Folder, error) {
+	id, err := parseFolderUint(c.Params("id"))
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	return h.perms.Folder(middleware.UserIDFromToken(c), id, need)
+}
+
+// CreateFolder creates {"name", "parent_id"}. Inside a folder shared with
+// the caller as editor, the new folder belongs to that folder's owner.
 func (h *FolderHandler) CreateFolder(c *fiber.Ctx) error {
 	uid := middleware.UserIDFromToken(c)
 	var req struct {
@@ -28,7 +45,22 @@ func (h *FolderHandler) CreateFolder(c *fiber.Ctx) error {
 	if err := utils.BindAndValidate(c, &req); err != nil {
 		return utils.Respond(c, err)
 	}
-	f := &models.Folder{UserID: uid, Name: req.Name, ParentID: req.ParentID}
+	name, err := utils.CleanFileName("name", req.Name)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	owner := uid
+	if req.ParentID != nil {
+		parent, err := h.perms.Folder(uid, *req.ParentID, types.RoleEditor)
+		if err != nil {
+			return utils.Respond(c, err)
+		}
+		if parent.Trashed {
+			return utils.Respond(c, utils.NewFieldError(fiber.StatusConflict, "parent_id", "folder is in the trash"))
+		}
+		owner = parent.UserID
+	}
+	f := &models.Folder{UserID: owner, Name: name, ParentID: req.ParentID}
 	if err := h.repo.Create(f); err != nil {
 		slog.Error("create folder", "err", err)
 		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "create failed"))
@@ -36,6 +68,8 @@ func (h *FolderHandler) CreateFolder(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(f)
 }
 
+// ListFolders lists the subfolders of ?parent_id=N (default the root). A
+// folder shared with the caller lists its owner's subfolders.
 func (h *FolderHandler) ListFolders(c *fiber.Ctx) error {
 	uid := middleware.UserIDFromToken(c)
 	var parentID *uint
@@ -45,6 +79,13 @@ func (h *FolderHandler) ListFolders(c *fiber.Ctx) error {
 			parentID = &id
 		}
 	}
+	if parentID != nil {
+		parent, err := h.perms.Folder(uid, *parentID, types.RoleViewer)
+		if err != nil {
+			return utils.Respond(c, err)
+		}
+		uid = parent.UserID
+	}
 	folders, err := h.repo.ListByParent(uid, parentID)
 	if err != nil {
 		slog.Error("list folders", "err", err)
@@ -63,46 +104,163 @@ func (h *FolderHandler) GetTrashedFolders(c *fiber.Ctx) error {
 	return c.JSON(folders)
 }
 
+// TrashFolder moves a folder to its owner's trash; editors may do this too.
 func (h *FolderHandler) TrashFolder(c *fiber.Ctx) error {
-	uid := middleware.UserIDFromToken(c)
-	id, err := parseFolderUint(c.Params("id"))
+	f, err := h.folder(c, types.RoleEditor)
 	if err != nil {
-		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id"))
+		return utils.Respond(c, err)
 	}
-	if err := h.repo.UpdateTrashed(id, uid, true); err != nil {
-		slog.Error("trash folder", "id", id, "err", err)
-		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "update failed"))
+	if err := h.trash.TrashFolder(f.UserID, f.ID); err != nil {
+		return utils.Respond(c, err)
 	}
-	slog.Info("folder trashed", "id", id, "user", uid)
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// RestoreFolder takes a folder and what it took down out of the trash. An
+// optional {"parent_id": N|null} restores it elsewhere — required while its
+// parent is trashed.
 func (h *FolderHandler) RestoreFolder(c *fiber.Ctx) error {
+	f, err := h.folder(c, types.RoleOwner)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	dest, move, err := restoreTarget(c, "parent_id")
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	f, err = h.trash.RestoreFolder(f.UserID, f.ID, dest, move)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.JSON(f)
+}
+
+// RenameFolder changes a folder's name, with the same body and conflict
+// policies as RenameFile.
+func (h *FolderHandler) RenameFolder(c *fiber.Ctx) error {
+	f, err := h.folder(c, types.RoleEditor)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	id := f.ID
+	if f.Trashed {
+		return utils.Respond(c, utils.NewError(fiber.StatusConflict, "folder is in the trash"))
+	}
+	name, conflict, err := bindRename(c)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+
+	res, err := h.repo.Rename(id, f.UserID, name, conflict)
+	if errors.Is(err, types.ErrNameTaken) {
+		return utils.Respond(c, utils.NewFieldError(fiber.StatusConflict, "name", "a folder with this name already exists here"))
+	}
+	if err != nil {
+		slog.Error("rename folder", "id", id, "err", err)
+		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "rename failed"))
+	}
+	slog.Info("folder renamed", "id", id, "from", f.Name, "to", res.Name, "replaced", res.Replaced)
+	f.Name = res.Name
+	return c.JSON(f)
+}
+
+// MoveFolder re-parents a folder with everything inside:
+// {"parent_id": N|null, "on_conflict": …}. A missing parent_id is the root.
+// The destination must be in the same drive.
+func (h *FolderHandler) MoveFolder(c *fiber.Ctx) error {
 	uid := middleware.UserIDFromToken(c)
-	id, err := parseFolderUint(c.Params("id"))
+	var req struct {
+		ParentID   *uint              `json:"parent_id"`
+		OnConflict types.NameConflict `json:"on_conflict"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid request body"))
+	}
+	conflict, err := parseConflict(req.OnConflict)
 	if err != nil {
-		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id"))
+		return utils.Respond(c, err)
 	}
-	if err := h.repo.UpdateTrashed(id, uid, false); err != nil {
-		slog.Error("restore folder", "id", id, "err", err)
-		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "update failed"))
+
+	f, err := h.folder(c, types.RoleEditor)
+	if err != nil {
+		return utils.Respond(c, err)
 	}
-	slog.Info("folder restored", "id", id, "user", uid)
-	return c.SendStatus(fiber.StatusNoContent)
+	id := f.ID
+	if f.Trashed {
+		return utils.Respond(c, utils.NewError(fiber.StatusConflict, "folder is in the trash"))
+	}
+	if err := h.perms.Destination(uid, f.UserID, "parent_id", req.ParentID); err != nil {
+		return utils.Respond(c, err)
+	}
+
+	res, err := h.repo.Move(id, f.UserID, req.ParentID, conflict)
+	switch {
+	case errors.Is(err, types.ErrFolderCycle):
+		return utils.Respond(c, utils.NewFieldError(fiber.StatusConflict, "parent_id", "a folder can't be moved into itself or one of its subfolders"))
+	case errors.Is(err, types.ErrNameTaken):
+		return utils.Respond(c, utils.NewFieldError(fiber.StatusConflict, "name", "a folder with this name already exists there"))
+	case err != nil:
+		slog.Error("move folder", "id", id, "err", err)
+		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "move failed"))
+	}
+	slog.Info("folder moved", "id", id, "user", uid, "parent_id", req.ParentID, "name", res.Name, "replaced", res.Replaced)
+	f.ParentID = req.ParentID
+	f.Name     = res.Name
+	return c.JSON(f)
+}
+
+// CopyFolder copies a folder with its live contents:
+// {"parent_id": N|null, "on_conflict": …}. Without parent_id the copy goes
+// next to the original; either way it stays in the owner's drive.
+func (h *FolderHandler) CopyFolder(c *fiber.Ctx) error {
+	f, err := h.folder(c, types.RoleEditor)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	dest, elsewhere, conflict, err := copyRequest(c, "parent_id")
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	if elsewhere {
+		if err := h.perms.Destination(middleware.UserIDFromToken(c), f.UserID, "parent_id", dest); err != nil {
+			return utils.Respond(c, err)
+		}
+	}
+	cp, err := h.copies.CopyFolder(f.UserID, f.ID, dest, elsewhere, conflict)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.Status(copyStatus(cp)).JSON(cp)
 }
 
 func (h *FolderHandler) DeleteFolder(c *fiber.Ctx) error {
-	uid := middleware.UserIDFromToken(c)
-	id, err := parseFolderUint(c.Params("id"))
+	f, err := h.folder(c, types.RoleOwner)
 	if err != nil {
-		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id"))
+		return utils.Respond(c, err)
 	}
-	if err := h.repo.Delete(id, uid); err != nil {
+	uid, id := f.UserID, f.ID
+	del, err := h.repo.DeleteTree(id, uid)
+	if err != nil {
 		slog.Error("delete folder", "id", id, "err", err)
 		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "delete failed"))
 	}
-	slog.Info("folder deleted", "id", id, "user", uid)
-	return c.SendStatus(fiber.StatusNoContent)
+	if del.Folders == 0 {
+		return utils.Respond(c, utils.NewError(fiber.StatusNotFound, "folder not found"))
+	}
+
+	// Rows are gone — storage is cleaned up by a job that retries on failure
+	if err := h.blobs.Purge(uid, del.Objects); err != nil {
+		slog.Error("delete folder: queueing storage cleanup failed", "id", id, "objects", len(del.Objects), "err", err)
+	}
+	slog.Info("folder deleted",
+		"id",           id,
+		"user",         uid,
+		"folders",      del.Folders,
+		"files",        del.Files,
+		"bytes",        del.Bytes,
+		"stored_bytes", del.StoredBytes,
+	)
+	return c.JSON(del)
 }
 
 func parseFolderUint(s string) (uint, error) {
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"file-transfer-backend/middleware"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type GrantHandler struct {
+	perms types.IPermissionService
+}
+
+func NewGrantHandler(perms types.IPermissionService) *GrantHandler {
+	return &GrantHandler{perms: perms}
+}
+
+// item reads the :id of a /files/:id/grants or /folders/:id/grants route.
+func item(c *fiber.Ctx, folder bool) (fileID, folderID *uint, err error) {
+	id, err := parseUint(c.Params("id"))
+	if err != nil {
+		return nil, nil, utils.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	if folder {
+		return nil, &id, nil
+	}
+	return &id, nil, nil
+}
+
+func (h *GrantHandler) FileGrants(c *fiber.Ctx) error   { return h.list(c, false) }
+func (h *GrantHandler) FolderGrants(c *fiber.Ctx) error { return h.list(c, true) }
+func (h *GrantHandler) GrantFile(c *fiber.Ctx) error    { return h.grant(c, false) }
+func (h *GrantHandler) GrantFolder(c *fiber.Ctx) error  { return h.grant(c, true) }
+
+// list returns who an item the caller owns is shared with.
+func (h *GrantHandler) list(c *fiber.Ctx, folder bool) error {
+	fileID, folderID, err := item(c, folder)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	grants, err := h.perms.Grants(middleware.UserIDFromToken(c), fileID, folderID)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.JSON(grants)
+}
+
+// grant shares an item the caller owns: {"email", "role"}. Granting again
+// to the same user changes their role.
+func (h *GrantHandler) grant(c *fiber.Ctx, folder bool) error {
+	fileID, folderID, err := item(c, folder)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	var req struct {
+		Email string     `json:"email" validate:"required"`
+		Role  types.Role `json:"role"  validate:"required"`
+	}
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return utils.Respond(c, err)
+	}
+	g, err := h.perms.Grant(middleware.UserIDFromToken(c), fileID, folderID, req.Email, req.Role)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(g)
+}
+
+// RevokeGrant removes a grant. The owner may revoke any of theirs; a grantee
+// may remove themselves.
+func (h *GrantHandler) RevokeGrant(c *fiber.Ctx) error {
+	id, err := parseUint(c.Params("id"))
+	if err != nil {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id"))
+	}
+	if err := h.perms.Revoke(middleware.UserIDFromToken(c), id); err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SharedWithMe lists the files and folders other users granted the caller,
+// each with its role and owner. Browse into a folder with the usual
+// ?folder_id= / ?parent_id= listings.
+func (h *GrantHandler) SharedWithMe(c *fiber.Ctx) error {
+	shared, err := h.perms.SharedWithMe(middleware.UserIDFromToken(c))
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.JSON(shared)
+}
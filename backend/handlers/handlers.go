@@ -2,21 +2,19 @@ package handlers
 
 import (
 	"bytes"
-	"context"
-	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"file-transfer-backend/config"
 	"file-transfer-backend/middleware"
 	"file-transfer-backend/models"
-	"file-transfer-backend/services"
 	"file-transfer-backend/types"
 	"file-transfer-backend/utils"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"strconv"
 	"time"
 
@@ -38,6 +36,7 @@ type initMsg struct {
 	RelPath  string `json:"rel_path"`
 	FileSize int64  `json:"file_size"`
 	FolderID *uint  `json:"folder_id"`
+	Binary   bool   `json:"binary"` // client wants to send chunks as binary frames
 }
 
 type chunkMsg struct {
@@ -52,6 +51,30 @@ type completeMsg struct {
 	FileUploadID uint `json:"file_upload_id"`
 }
 
+type resumeMsg struct {
+	FileUploadID uint `json:"file_upload_id"`
+	Binary       bool `json:"binary"`
+}
+
+// Binary chunk frame layout (all integers big-endian):
+//
+//	offset  size  field
+//	0       4     file_upload_id
+//	4       4     chunk_index
+//	8       4     total_chunks
+//	12      32    SHA-256 of payload (raw, not hex)
+//	44      …     payload bytes
+//
+// Binary frames skip base64 and JSON entirely. They are only accepted for
+// uploads that negotiated "binary": true in init/resume; the JSON "chunk"
+// message keeps working for older clients.
+const binaryChunkHeaderLen = 44
+
+// wsUpload is the per-connection state of one upload in flight.
+type wsUpload struct {
+	binary bool // negotiated binary framing
+}
+
 type progressMsg struct {
 	Type         string  `json:"type"`
 	FileUploadID uint    `json:"file_upload_id"`
@@ -64,81 +87,81 @@ type progressMsg struct {
 // ─── WebSocket upload handler ─────────────────────────────────────────────────
 
 type UploadWSHandler struct {
-	repo types.IFileRepository
-	cs   types.IChecksumService
-	cfg  *config.UploadConfig
-	s3   *services.S3Service // nil = local storage
+	uploads types.IUploadService
 }
 
-func NewUploadWSHandler(
-	repo types.IFileRepository,
-	cs   types.IChecksumService,
-	cfg  *config.UploadConfig,
-	s3   *services.S3Service,
-) *UploadWSHandler {
-	return &UploadWSHandler{repo: repo, cs: cs, cfg: cfg, s3: s3}
+func NewUploadWSHandler(uploads types.IUploadService) *UploadWSHandler {
+	return &UploadWSHandler{uploads: uploads}
 }
 
 func (h *UploadWSHandler) HandleUpload(conn *websocket.Conn) {
 	uid := middleware.WSUserID(conn.Locals)
 	defer conn.Close()
 
-	chunks := map[uint]map[int][]byte{}
-	totals := map[uint]int{}
+	// Uploads started or resumed on this connection. The bytes themselves live
+	// in staging. On disconnect they stay on disk so a later "resume" — on a new
+	// connection or after a restart — can pick them up again.
+	uploads := map[uint]*wsUpload{}
+	defer func() {
+		for id := range uploads {
+			h.uploads.Suspend(id)
+		}
+	}()
 
 	for {
-		_, raw, err := conn.ReadMessage()
+		mt, raw, err := conn.ReadMessage()
 		if err != nil {
 			return
 		}
+		if mt == websocket.BinaryMessage {
+			h.wsBinaryChunk(conn, uid, raw, uploads); continue
+		}
 		var msg wsMsg
 		if err := json.Unmarshal(raw, &msg); err != nil {
 			wsError(conn, "invalid message"); continue
 		}
 		switch msg.Type {
-		case "init":     h.wsInit(conn, uid, msg.Data, chunks)
-		case "chunk":    h.wsChunk(conn, msg.Data, chunks, totals)
-		case "complete": h.wsComplete(conn, uid, msg.Data, chunks, totals)
+		case "init":     h.wsInit(conn, uid, msg.Data, uploads)
+		case "chunk":    h.wsChunk(conn, uid, msg.Data, uploads)
+		case "complete": h.wsComplete(conn, uid, msg.Data, uploads)
+		case "resume":   h.wsResume(conn, uid, msg.Data, uploads)
+		case "cancel":   h.wsCancel(conn, uid, msg.Data, uploads)
 		default:         wsError(conn, "unknown type: "+msg.Type)
 		}
 	}
 }
 
-func (h *UploadWSHandler) wsInit(conn *websocket.Conn, uid uint, data json.RawMessage, chunks map[uint]map[int][]byte) {
+func (h *UploadWSHandler) wsInit(conn *websocket.Conn, uid uint, data json.RawMessage, uploads map[uint]*wsUpload) {
 	var req initMsg
 	if err := json.Unmarshal(data, &req); err != nil {
 		slog.Error("wsInit: bad JSON", "err", err)
 		wsError(conn, "bad init"); return
 	}
 
-	fu := &models.FileUpload{
-		UserID:   uid,
-		FolderID: req.FolderID,
+	fu, err := h.uploads.Init(uid, types.UploadInit{
 		FileName: req.FileName,
 		FileType: req.FileType,
 		FileSize: req.FileSize,
 		Checksum: req.Checksum,
-		Status:   "pending",
 		RelPath:  req.RelPath,
-	}
-	if err := h.repo.Create(fu); err != nil {
-		slog.Error("wsInit: db create failed", "err", err, "user", uid)
-		wsError(conn, "init failed"); return
+		FolderID: req.FolderID,
+	})
+	if err != nil {
+		wsFail(conn, err); return
 	}
 
-	// ✅ LOG: upload started
-	slog.Info("⬆  upload started",
-		"file_id",   fu.ID,
-		"file_name", fu.FileName,
-		"file_size", fu.FileSize,
-		"user",      uid,
-	)
+	// Content already stored — the upload is complete without any chunks
+	if fu.Status == "completed" {
+		conn.WriteJSON(map[string]any{"type": "init_ack", "file_upload_id": fu.ID, "file_name": fu.FileName, "deduplicated": true})
+		conn.WriteJSON(map[string]any{"type": "done", "file": fu})
+		return
+	}
 
-	chunks[fu.ID] = map[int][]byte{}
-	conn.WriteJSON(map[string]any{"type": "init_ack", "file_upload_id": fu.ID, "file_name": fu.FileName})
+	uploads[fu.ID] = &wsUpload{binary: req.Binary}
+	conn.WriteJSON(map[string]any{"type": "init_ack", "file_upload_id": fu.ID, "file_name": fu.FileName, "binary": req.Binary})
 }
 
-func (h *UploadWSHandler) wsChunk(conn *websocket.Conn, data json.RawMessage, chunks map[uint]map[int][]byte, totals map[uint]int) {
+func (h *UploadWSHandler) wsChunk(conn *websocket.Conn, uid uint, data json.RawMessage, uploads map[uint]*wsUpload) {
 	var req chunkMsg
 	if err := json.Unmarshal(data, &req); err != nil {
 		slog.Error("wsChunk: bad JSON", "err", err)
@@ -151,191 +174,111 @@ func (h *UploadWSHandler) wsChunk(conn *websocket.Conn, data json.RawMessage, ch
 		wsError(conn, "bad base64"); return
 	}
 
-	if sum := sha256hex(raw); sum != req.Checksum {
-		slog.Warn("wsChunk: checksum mismatch", "file_id", req.FileUploadID, "chunk", req.ChunkIndex)
-		wsError(conn, fmt.Sprintf("checksum mismatch chunk %d", req.ChunkIndex)); return
+	h.acceptChunk(conn, uid, uploads, req.FileUploadID, req.ChunkIndex, req.TotalChunks, req.Checksum, raw)
+}
+
+// wsBinaryChunk handles a raw binary frame (see binaryChunkHeaderLen).
+func (h *UploadWSHandler) wsBinaryChunk(conn *websocket.Conn, uid uint, frame []byte, uploads map[uint]*wsUpload) {
+	if len(frame) < binaryChunkHeaderLen {
+		wsError(conn, "short binary frame"); return
+	}
+	id    := uint(binary.BigEndian.Uint32(frame[0:4]))
+	index := int(binary.BigEndian.Uint32(frame[4:8]))
+	total := int(binary.BigEndian.Uint32(frame[8:12]))
+	sum   := hex.EncodeToString(frame[12:binaryChunkHeaderLen])
+
+	if up, ok := uploads[id]; ok && !up.binary {
+		slog.Warn("wsBinaryChunk: binary not negotiated", "file_id", id)
+		wsError(conn, "binary frames not negotiated for this upload"); return
 	}
 
-	fc, ok := chunks[req.FileUploadID]
-	if !ok {
-		slog.Error("wsChunk: unknown file_upload_id", "file_id", req.FileUploadID)
+	h.acceptChunk(conn, uid, uploads, id, index, total, sum, frame[binaryChunkHeaderLen:])
+}
+
+// acceptChunk hands one decoded chunk to the upload service and reports
+// progress. Shared by the JSON and binary framings.
+func (h *UploadWSHandler) acceptChunk(conn *websocket.Conn, uid uint, uploads map[uint]*wsUpload, id uint, index, total int, checksum string, raw []byte) {
+	if _, ok := uploads[id]; !ok {
+		slog.Error("wsChunk: unknown file_upload_id", "file_id", id)
 		wsError(conn, "unknown file_upload_id"); return
 	}
 
-	fc[req.ChunkIndex] = raw
-	totals[req.FileUploadID] = req.TotalChunks
-
-	if len(fc) == 1 {
-		if fu, err := h.repo.GetByID(req.FileUploadID); err == nil {
-			fu.Status      = "uploading"
-			fu.TotalChunks = req.TotalChunks
-			h.repo.Update(fu)
-		}
+	received, total, err := h.uploads.WriteChunk(uid, id, index, total, checksum, raw)
+	if err != nil {
+		wsFail(conn, err); return
 	}
 
 	conn.WriteJSON(progressMsg{
 		Type:         "progress",
-		FileUploadID: req.FileUploadID,
-		Uploaded:     len(fc),
-		Total:        req.TotalChunks,
-		Percent:      float64(len(fc)) / float64(req.TotalChunks) * 100,
+		FileUploadID: id,
+		Uploaded:     received,
+		Total:        total,
+		Percent:      float64(received) / float64(total) * 100,
 		Status:       "uploading",
 	})
 }
 
-func (h *UploadWSHandler) wsComplete(conn *websocket.Conn, uid uint, data json.RawMessage, chunks map[uint]map[int][]byte, totals map[uint]int) {
+func (h *UploadWSHandler) wsComplete(conn *websocket.Conn, uid uint, data json.RawMessage, uploads map[uint]*wsUpload) {
 	var req completeMsg
 	if err := json.Unmarshal(data, &req); err != nil {
 		slog.Error("wsComplete: bad JSON", "err", err)
 		wsError(conn, "bad complete"); return
 	}
 
-	fu, err := h.repo.GetByID(req.FileUploadID)
-	if err != nil || fu.UserID != uid {
-		slog.Error("wsComplete: not found or forbidden", "file_id", req.FileUploadID, "user", uid)
-		wsError(conn, "not found or forbidden"); return
+	if _, ok := uploads[req.FileUploadID]; !ok {
+		slog.Error("wsComplete: upload not on this connection", "file_id", req.FileUploadID)
+		wsError(conn, "no chunks"); return
 	}
 
-	fc, ok := chunks[req.FileUploadID]
-	if !ok || len(fc) == 0 {
-		slog.Error("wsComplete: no chunks in memory", "file_id", req.FileUploadID)
-		wsError(conn, "no chunks"); return
+	fu, err := h.uploads.Complete(uid, req.FileUploadID)
+	if err != nil {
+		wsFail(conn, err); return
 	}
+	delete(uploads, req.FileUploadID)
 
-	total := totals[req.FileUploadID]
-	if total == 0 { total = len(fc) }
+	// S3 uploads reply with status "processing" — the client doesn't wait for S3
+	conn.WriteJSON(map[string]any{"type": "done", "file": fu})
+}
 
-	// Assemble chunks into a single byte slice
-	var buf bytes.Buffer
-	for i := range total {
-		chunk, ok := fc[i]
-		if !ok {
-			slog.Error("wsComplete: missing chunk", "file_id", req.FileUploadID, "chunk", i)
-			wsError(conn, fmt.Sprintf("missing chunk %d", i)); return
-		}
-		buf.Write(chunk)
+// wsResume re-attaches an interrupted upload to this connection and tells the
+// client which chunk indices it no longer needs to send.
+func (h *UploadWSHandler) wsResume(conn *websocket.Conn, uid uint, data json.RawMessage, uploads map[uint]*wsUpload) {
+	var req resumeMsg
+	if err := json.Unmarshal(data, &req); err != nil {
+		slog.Error("wsResume: bad JSON", "err", err)
+		wsError(conn, "bad resume"); return
 	}
-	fileBytes := buf.Bytes()
 
-	// Verify whole-file checksum
-	if sha256hex(fileBytes) != fu.Checksum {
-		fu.Status = "failed"
-		h.repo.Update(fu)
-		slog.Error("wsComplete: file checksum mismatch", "file_id", fu.ID, "file_name", fu.FileName)
-		wsError(conn, "file checksum mismatch"); return
+	fu, uploaded, err := h.uploads.Resume(uid, req.FileUploadID)
+	if err != nil {
+		wsFail(conn, err); return
 	}
+	uploads[fu.ID] = &wsUpload{binary: req.Binary}
+
+	conn.WriteJSON(map[string]any{
+		"type":            "resume_ack",
+		"file_upload_id":  fu.ID,
+		"file_name":       fu.FileName,
+		"uploaded_chunks": uploaded,
+		"total_chunks":    fu.TotalChunks,
+		"binary":          req.Binary,
+	})
+}
 
-	// Free chunk memory immediately — no longer needed
-	delete(chunks, req.FileUploadID)
-
-	if h.s3 != nil {
-		// ── ASYNC S3 upload ───────────────────────────────────────────────────
-		//
-		// We mark the file "processing" and reply done to the client RIGHT NOW.
-		// The actual S3 PutObject runs in a goroutine. The user's browser
-		// immediately shows the file as "processing" in the UI; once the goroutine
-		// finishes, the DB row is updated to "completed" and the next file-list
-		// poll will show it normally.
-		//
-		// This means large files (100+ MB) don't block the WebSocket connection.
-
-		fu.Status = "processing"
-		h.repo.Update(fu)
-
-		// Reply to client immediately — they don't wait for S3
-		conn.WriteJSON(map[string]any{"type": "done", "file": fu})
-
-		slog.Info("⏳ queued for S3 upload",
-			"file_id",   fu.ID,
-			"file_name", fu.FileName,
-			"file_size", len(fileBytes),
-		)
-
-		// Capture everything needed by the goroutine — do NOT pass conn or fc
-		fuID      := fu.ID
-		fuName    := fu.FileName
-		fuType    := fu.FileType
-		fuRelPath := fu.RelPath
-		fuFolderID := fu.FolderID
-		repo      := h.repo
-		s3svc     := h.s3
-
-		go func() {
-			start := time.Now()
-
-			var folderID uint
-			if fuFolderID != nil { folderID = *fuFolderID }
-
-			relPath := fuRelPath
-			if relPath == "" { relPath = fuName }
-
-			s3Key := services.BuildKey(uid, folderID, relPath)
-
-			if _, err := s3svc.Upload(context.Background(), s3Key, fileBytes, fuType); err != nil {
-				slog.Error("✗  S3 upload failed",
-					"file_id",   fuID,
-					"file_name", fuName,
-					"key",       s3Key,
-					"err",       err,
-					"elapsed",   time.Since(start).Round(time.Millisecond),
-				)
-				// Mark as failed in DB so the UI can show error state
-				if record, dbErr := repo.GetByID(fuID); dbErr == nil {
-					record.Status = "failed"
-					repo.Update(record)
-				}
-				return
-			}
-
-			// Update DB: completed + store S3 key as FilePath
-			record, dbErr := repo.GetByID(fuID)
-			if dbErr != nil {
-				slog.Error("✗  S3 post-upload: db fetch failed", "file_id", fuID, "err", dbErr)
-				return
-			}
-			record.Status   = "completed"
-			record.FilePath = s3Key
-			repo.Update(record)
-
-			// ✅ LOG: upload finished
-			slog.Info("✓  upload complete (S3)",
-				"file_id",   fuID,
-				"file_name", fuName,
-				"key",       s3Key,
-				"elapsed",   time.Since(start).Round(time.Millisecond),
-			)
-		}()
-
-	} else {
-		// ── Synchronous local write ───────────────────────────────────────────
-		dir := filepath.Join(h.cfg.Directory, fmt.Sprint(uid))
-		if fu.FolderID != nil { dir = filepath.Join(dir, fmt.Sprint(*fu.FolderID)) }
-		outPath := filepath.Join(dir, filepath.FromSlash(fu.RelPath))
-		if fu.RelPath == "" { outPath = filepath.Join(dir, fu.FileName) }
-
-		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
-			slog.Error("wsComplete: mkdir failed", "path", filepath.Dir(outPath), "err", err)
-			wsError(conn, "mkdir failed"); return
-		}
-		if err := os.WriteFile(outPath, fileBytes, 0o644); err != nil {
-			slog.Error("wsComplete: write failed", "path", outPath, "err", err)
-			wsError(conn, "write failed"); return
-		}
-
-		fu.Status   = "completed"
-		fu.FilePath = outPath
-		h.repo.Update(fu)
-
-		// ✅ LOG: upload finished
-		slog.Info("✓  upload complete (local)",
-			"file_id",   fu.ID,
-			"file_name", fu.FileName,
-			"path",      outPath,
-			"size",      len(fileBytes),
-		)
+// wsCancel aborts an unfinished upload and discards everything staged (and,
+// for multipart storage, every part already sent) for it.
+func (h *UploadWSHandler) wsCancel(conn *websocket.Conn, uid uint, data json.RawMessage, uploads map[uint]*wsUpload) {
+	var req completeMsg
+	if err := json.Unmarshal(data, &req); err != nil {
+		slog.Error("wsCancel: bad JSON", "err", err)
+		wsError(conn, "bad cancel"); return
+	}
 
-		conn.WriteJSON(map[string]any{"type": "done", "file": fu})
+	if err := h.uploads.Cancel(uid, req.FileUploadID); err != nil {
+		wsFail(conn, err); return
 	}
+	delete(uploads, req.FileUploadID)
+	conn.WriteJSON(map[string]any{"type": "cancelled", "file_upload_id": req.FileUploadID})
 }
 
 func wsError(conn *websocket.Conn, msg string) {
@@ -343,39 +286,54 @@ func wsError(conn *websocket.Conn, msg string) {
 	conn.WriteJSON(map[string]any{"type": "error", "message": msg})
 }
 
-func sha256hex(b []byte) string {
-	s := sha256.Sum256(b)
-	return hex.EncodeToString(s[:])
+// wsFail forwards a service error to the client, unwrapping AppError messages.
+func wsFail(conn *websocket.Conn, err error) {
+	var ae *utils.AppError
+	if errors.As(err, &ae) {
+		wsError(conn, ae.Message); return
+	}
+	wsError(conn, err.Error())
 }
 
 // ─── REST file handler ────────────────────────────────────────────────────────
 
 type FileHandler struct {
-	repo types.IFileRepository
-	cfg  *config.UploadConfig
-	s3   *services.S3Service
+	repo    types.IFileRepository
+	uploads types.IUploadService
+	cfg     *config.UploadConfig
+	store   types.IStorage
+	blobs   types.IBlobService
+	trash   types.ITrashService
+	copies  types.ICopyService
+	perms   types.IPermissionService
 }
 
-func NewFileHandler(repo types.IFileRepository, cfg *config.UploadConfig, s3 *services.S3Service) *FileHandler {
-	return &FileHandler{repo: repo, cfg: cfg, s3: s3}
+func NewFileHandler(repo types.IFileRepository, uploads types.IUploadService, cfg *config.UploadConfig, store types.IStorage, blobs types.IBlobService, trash types.ITrashService, copies types.ICopyService, perms types.IPermissionService) *FileHandler {
+	return &FileHandler{repo: repo, uploads: uploads, cfg: cfg, store: store, blobs: blobs, trash: trash, copies: copies, perms: perms}
 }
 
-func (h *FileHandler) fileOwner(c *fiber.Ctx) (*models.FileUpload, error) {
+// file loads the :id file if the caller holds at least role need on it —
+// as its owner or through a grant. The error is an unwritten AppError for
+// the caller to Respond with.
+func (h *FileHandler) file(c *fiber.Ctx, need types.Role) (*models.FileUpload, error) {
 	id, err := parseUint(c.Params("id"))
-	if err != nil { return nil, utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id")) }
-	uid := middleware.UserIDFromToken(c)
-	file, err := h.repo.GetByID(id)
-	if err != nil { return nil, utils.Respond(c, utils.NewError(fiber.StatusNotFound, "not found")) }
-	if file.UserID != uid { return nil, utils.Respond(c, utils.NewError(fiber.StatusForbidden, "forbidden")) }
-	return file, nil
+	if err != nil { return nil, utils.NewError(fiber.StatusBadRequest, "invalid id") }
+	return h.perms.File(middleware.UserIDFromToken(c), id, need)
 }
 
+// ListFiles lists a folder (?folder_id=N, default the root). A folder shared
+// with the caller lists its owner's files.
 func (h *FileHandler) ListFiles(c *fiber.Ctx) error {
 	uid := middleware.UserIDFromToken(c)
 	var folderID *uint
 	if fid := c.Query("folder_id"); fid != "" {
 		if id, err := parseUint(fid); err == nil { folderID = &id }
 	}
+	if folderID != nil {
+		folder, err := h.perms.Folder(uid, *folderID, types.RoleViewer)
+		if err != nil { return utils.Respond(c, err) }
+		uid = folder.UserID
+	}
 	files, err := h.repo.ListByFolder(uid, folderID)
 	if err != nil { return utils.Respond(c, utils.NewError(500, "list")) }
 	return c.JSON(files)
@@ -400,104 +358,304 @@ func (h *FileHandler) GetTrashedFiles(c *fiber.Ctx) error {
 }
 
 // DownloadFile returns a short-lived download URL for the file.
-// For S3 files: returns a presigned URL the browser can fetch directly.
-// For local files: returns a /api/files/:id/stream URL the server will serve.
+// Backends that can presign (S3): returns {url} the browser can fetch directly.
+// Others (local disk, memory): streams the bytes through the server, with
+// Range and conditional request support (see serveFile).
 // The frontend calls this via fetch (with Authorization header), then opens the URL.
 func (h *FileHandler) DownloadFile(c *fiber.Ctx) error {
-	file, err := h.fileOwner(c)
-	if err != nil { return err }
+	file, err := h.file(c, types.RoleViewer)
+	if err != nil { return utils.Respond(c, err) }
 
-	if file.Status == "processing" {
-		return utils.Respond(c, utils.NewError(fiber.StatusConflict, "file is still uploading to cloud storage, try again shortly"))
-	}
+	if err := downloadable(file); err != nil { return utils.Respond(c, err) }
 
-	if h.s3 != nil && file.FilePath != "" {
-		// Generate a 15-minute presigned S3 URL and return it as JSON.
-		// The browser fetches this URL directly from S3 — no server traffic.
-		url, err := h.s3.PresignDownload(c.Context(), file.FilePath, file.FileName, 15*time.Minute)
-		if err != nil {
-			slog.Error("presign download failed", "file_id", file.ID, "err", err)
-			return utils.Respond(c, utils.NewError(500, "failed to generate download link"))
-		}
-		slog.Info("download link issued (S3)", "file_id", file.ID, "file_name", file.FileName)
+	// Generate a 15-minute presigned URL and return it as JSON.
+	// The browser fetches this URL directly from storage — no server traffic.
+	url, err := h.store.Presign(c.Context(), file.FilePath, file.FileName, 15*time.Minute)
+	if err != nil {
+		slog.Error("presign download failed", "file_id", file.ID, "err", err)
+		return utils.Respond(c, utils.NewError(500, "failed to generate download link"))
+	}
+	if url != "" {
+		slog.Info("download link issued", "file_id", file.ID, "file_name", file.FileName, "storage", h.store.Name())
 		return c.JSON(fiber.Map{"url": url, "file_name": file.FileName})
 	}
 
-	// Local storage — stream the file directly
-	if file.FilePath == "" {
-		return utils.Respond(c, utils.NewError(404, "file not found on disk"))
-	}
-	slog.Info("download served (local)", "file_id", file.ID, "file_name", file.FileName)
-	c.Set("Content-Disposition", `attachment; filename="`+file.FileName+`"`)
-	return c.SendFile(file.FilePath)
+	// No presigned URLs — stream the object through the server
+	return serveFile(c, h.store, file, nil)
 }
 
+// MoveFile moves a file into another folder of the same drive: {"folder_id": N|null}.
 func (h *FileHandler) MoveFile(c *fiber.Ctx) error {
-	file, err := h.fileOwner(c)
-	if err != nil { return err }
+	file, err := h.file(c, types.RoleEditor)
+	if err != nil { return utils.Respond(c, err) }
 	var req struct{ FolderID *uint `json:"folder_id"` }
 	if err := c.BodyParser(&req); err != nil { return utils.Respond(c, utils.NewError(400, "bad body")) }
+	if err := h.perms.Destination(middleware.UserIDFromToken(c), file.UserID, "folder_id", req.FolderID); err != nil { return utils.Respond(c, err) }
 	if err := h.repo.UpdateFolderID(file.ID, req.FolderID); err != nil { return utils.Respond(c, utils.NewError(500, "update")) }
 	file.FolderID = req.FolderID
 	return c.JSON(file)
 }
 
+// RenameFile changes a file's name: {"name": "…", "on_conflict": "fail"|"rename"|"replace"}.
+func (h *FileHandler) RenameFile(c *fiber.Ctx) error {
+	file, err := h.file(c, types.RoleEditor)
+	if err != nil { return utils.Respond(c, err) }
+	if file.Trashed { return utils.Respond(c, utils.NewError(fiber.StatusConflict, "file is in the trash")) }
+	name, conflict, err := bindRename(c)
+	if err != nil { return utils.Respond(c, err) }
+
+	res, err := h.repo.Rename(file.ID, file.UserID, name, conflict)
+	if errors.Is(err, types.ErrNameTaken) {
+		return utils.Respond(c, utils.NewFieldError(fiber.StatusConflict, "name", "a file with this name already exists here"))
+	}
+	if err != nil { return utils.Respond(c, utils.NewError(500, "rename")) }
+	slog.Info("file renamed", "file_id", file.ID, "from", file.FileName, "to", res.Name, "replaced", res.Replaced)
+	file.FileName = res.Name
+	return c.JSON(file)
+}
+
+// bindRename reads a rename body; on_conflict defaults to "fail".
+func bindRename(c *fiber.Ctx) (string, types.NameConflict, error) {
+	var req struct {
+		Name       string             `json:"name"        validate:"required"`
+		OnConflict types.NameConflict `json:"on_conflict"`
+	}
+	if err := utils.BindAndValidate(c, &req); err != nil { return "", "", err }
+	name, err := utils.CleanFileName("name", req.Name)
+	if err != nil { return "", "", err }
+	conflict, err := parseConflict(req.OnConflict)
+	if err != nil { return "", "", err }
+	return name, conflict, nil
+}
+
+func parseConflict(v types.NameConflict) (types.NameConflict, error) {
+	switch v {
+	case "":
+		return types.ConflictFail, nil
+	case types.ConflictFail, types.ConflictRename, types.ConflictReplace:
+		return v, nil
+	}
+	return "", utils.NewFieldError(fiber.StatusBadRequest, "on_conflict", `on_conflict must be "fail", "rename" or "replace"`)
+}
+
 func (h *FileHandler) ToggleStar(c *fiber.Ctx) error {
-	file, err := h.fileOwner(c)
-	if err != nil { return err }
+	file, err := h.file(c, types.RoleOwner)
+	if err != nil { return utils.Respond(c, err) }
 	file.Starred = !file.Starred
 	if err := h.repo.Update(file); err != nil { return utils.Respond(c, utils.NewError(500, "update")) }
 	return c.JSON(file)
 }
 
+// TrashFile moves a file to its owner's trash; editors may do this too.
 func (h *FileHandler) TrashFile(c *fiber.Ctx) error {
-	file, err := h.fileOwner(c)
-	if err != nil { return err }
-	if err := h.repo.UpdateTrashed(file.ID, true); err != nil { return utils.Respond(c, utils.NewError(500, "update")) }
+	file, err := h.file(c, types.RoleEditor)
+	if err != nil { return utils.Respond(c, err) }
+	if err := h.trash.TrashFile(file.UserID, file.ID); err != nil { return utils.Respond(c, err) }
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// RestoreFile takes a file out of the trash. An optional {"folder_id": N|null}
+// restores it into another folder — required while its own is trashed.
 func (h *FileHandler) RestoreFile(c *fiber.Ctx) error {
-	file, err := h.fileOwner(c)
-	if err != nil { return err }
-	if err := h.repo.UpdateTrashed(file.ID, false); err != nil { return utils.Respond(c, utils.NewError(500, "update")) }
-	file.Trashed = false
+	file, err := h.file(c, types.RoleOwner)
+	if err != nil { return utils.Respond(c, err) }
+	dest, move, err := restoreTarget(c, "folder_id")
+	if err != nil { return utils.Respond(c, err) }
+	file, err = h.trash.RestoreFile(file.UserID, file.ID, dest, move)
+	if err != nil { return utils.Respond(c, err) }
 	return c.JSON(file)
 }
 
-func (h *FileHandler) DeleteFile(c *fiber.Ctx) error {
-	file, err := h.fileOwner(c)
-	if err != nil { return err }
-
-	if h.s3 != nil && file.FilePath != "" {
-		if err := h.s3.Delete(c.Context(), file.FilePath); err != nil {
-			slog.Warn("s3 delete failed — continuing with DB delete",
-				"file_id", file.ID,
-				"key",     file.FilePath,
-				"err",     err,
-			)
-		}
-	} else if file.FilePath != "" {
-		os.Remove(file.FilePath)
+// restoreTarget reads an optional destination from a restore or copy body.
+// move is true when the key is present at all; null means the root.
+func restoreTarget(c *fiber.Ctx, key string) (dest *uint, move bool, err error) {
+	if len(c.Body()) == 0 {
+		return nil, false, nil
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return nil, false, utils.NewError(fiber.StatusBadRequest, "bad body")
+	}
+	raw, move := body[key]
+	if !move {
+		return nil, false, nil
+	}
+	if err := json.Unmarshal(raw, &dest); err != nil {
+		return nil, false, utils.NewFieldError(fiber.StatusBadRequest, key, "invalid "+key)
 	}
+	return dest, true, nil
+}
 
-	if err := h.repo.Delete(file.ID, middleware.UserIDFromToken(c)); err != nil {
-		return utils.Respond(c, utils.NewError(500, "delete"))
+// CopyFile copies a file: {"folder_id": N|null, "on_conflict": …}. Without
+// folder_id the copy goes next to the original. Copies stay in the owner's
+// drive and count against the owner's quota.
+func (h *FileHandler) CopyFile(c *fiber.Ctx) error {
+	file, err := h.file(c, types.RoleEditor)
+	if err != nil { return utils.Respond(c, err) }
+	dest, elsewhere, conflict, err := copyRequest(c, "folder_id")
+	if err != nil { return utils.Respond(c, err) }
+	if elsewhere {
+		if err := h.perms.Destination(middleware.UserIDFromToken(c), file.UserID, "folder_id", dest); err != nil { return utils.Respond(c, err) }
+	}
+	cp, err := h.copies.CopyFile(file.UserID, file.ID, dest, elsewhere, conflict)
+	if err != nil { return utils.Respond(c, err) }
+	return c.Status(copyStatus(cp)).JSON(cp)
+}
+
+// copyRequest reads a copy body. on_conflict defaults to "rename", since
+// copying next to the original always meets its name.
+func copyRequest(c *fiber.Ctx, key string) (*uint, bool, types.NameConflict, error) {
+	dest, elsewhere, err := restoreTarget(c, key)
+	if err != nil { return nil, false, "", err }
+	if len(c.Body()) == 0 { return dest, elsewhere, types.ConflictRename, nil }
+	var req struct{ OnConflict types.NameConflict `json:"on_conflict"` }
+	if err := json.Unmarshal(c.Body(), &req); err != nil { return nil, false, "", utils.NewError(fiber.StatusBadRequest, "bad body") }
+	if req.OnConflict == "" { return dest, elsewhere, types.ConflictRename, nil }
+	conflict, err := parseConflict(req.OnConflict)
+	return dest, elsewhere, conflict, err
+}
+
+// copyStatus is 202 while a job still copies bytes, 201 otherwise.
+func copyStatus(cp *types.Copy) int {
+	if cp.JobID != nil { return fiber.StatusAccepted }
+	return fiber.StatusCreated
+}
+
+func (h *FileHandler) DeleteFile(c *fiber.Ctx) error {
+	file, err := h.file(c, types.RoleOwner)
+	if err != nil { return utils.Respond(c, err) }
+
+	// Same path as folder delete and empty trash: rows and references go in
+	// one transaction, shared content leaves storage with its last reference
+	del, err := h.repo.DeleteFiles(file.UserID, []uint{file.ID})
+	if err != nil { return utils.Respond(c, utils.NewError(500, "delete")) }
+	if err := h.blobs.Purge(file.UserID, del.Objects); err != nil {
+		slog.Error("delete file: queueing storage cleanup failed", "file_id", file.ID, "err", err)
 	}
 	slog.Info("file deleted", "file_id", file.ID, "file_name", file.FileName)
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// ─── REST chunked upload ──────────────────────────────────────────────────────
+//
+// Plain-HTTP equivalent of the WebSocket protocol for CI scripts and proxies
+// that block WebSockets. Same checksum rules, same staging, same storage:
+//
+//	POST /api/uploads                      JSON init      → {file_upload_id, ...}
+//	PUT  /api/uploads/:id/chunks/:index    raw body, X-Chunk-Checksum: <sha256 hex>
+//	GET  /api/uploads/:id/chunks           indices already received (resume)
+//	POST /api/uploads/:id/complete         verify + store → file
+
+func (h *FileHandler) InitUpload(c *fiber.Ctx) error {
+	var req struct {
+		FileName    string `json:"file_name"    validate:"required"`
+		FileType    string `json:"file_type"`
+		FileSize    int64  `json:"file_size"`
+		Checksum    string `json:"checksum"     validate:"required"`
+		RelPath     string `json:"rel_path"`
+		FolderID    *uint  `json:"folder_id"`
+		TotalChunks int    `json:"total_chunks"`
+	}
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return utils.Respond(c, err)
+	}
+	fu, err := h.uploads.Init(middleware.UserIDFromToken(c), types.UploadInit{
+		FileName:    req.FileName,
+		FileType:    req.FileType,
+		FileSize:    req.FileSize,
+		Checksum:    req.Checksum,
+		RelPath:     req.RelPath,
+		FolderID:    req.FolderID,
+		TotalChunks: req.TotalChunks,
+	})
+	if err != nil { return utils.Respond(c, err) }
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"file_upload_id": fu.ID,
+		"chunk_size":     h.cfg.ChunkSize,
+		"max_chunk_size": h.cfg.MaxChunkSize,
+		"file":           fu,
+		"deduplicated":   fu.Status == "completed", // nothing to send — go straight to done
+	})
+}
+
+func (h *FileHandler) UploadChunk(c *fiber.Ctx) error {
+	id, err := parseUint(c.Params("id"))
+	if err != nil { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id")) }
+	index, err := strconv.Atoi(c.Params("index"))
+	if err != nil { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid chunk index")) }
+	checksum := c.Get("X-Chunk-Checksum")
+	if checksum == "" { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "X-Chunk-Checksum header required")) }
+	total, _ := strconv.Atoi(c.Get("X-Total-Chunks"))
+
+	// At most MaxChunkSize bytes are read, so one chunk is all a request
+	// ever holds in memory
+	limit := int64(h.cfg.MaxChunkSize)
+	if bodyLength(c) > limit { return utils.Respond(c, chunkTooLarge(limit)) }
+	data, err := io.ReadAll(io.LimitReader(bodyStream(c), limit+1))
+	if err != nil { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "could not read chunk")) }
+	if int64(len(data)) > limit { return utils.Respond(c, chunkTooLarge(limit)) }
+
+	received, total, err := h.uploads.WriteChunk(middleware.UserIDFromToken(c), id, index, total, checksum, data)
+	if err != nil { return utils.Respond(c, err) }
+	return c.JSON(fiber.Map{
+		"file_upload_id":   id,
+		"uploaded_chunks":  received,
+		"total_chunks":     total,
+		"progress_percent": float64(received) / float64(total) * 100,
+	})
+}
+
+func chunkTooLarge(limit int64) error {
+	return utils.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("chunk is larger than max_chunk_size (%d bytes)", limit))
+}
+
+func (h *FileHandler) CompleteUpload(c *fiber.Ctx) error {
+	id, err := parseUint(c.Params("id"))
+	if err != nil { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id")) }
+	fu, err := h.uploads.Complete(middleware.UserIDFromToken(c), id)
+	if err != nil { return utils.Respond(c, err) }
+	if fu.Status == "processing" {
+		return c.Status(fiber.StatusAccepted).JSON(fu)
+	}
+	return c.JSON(fu)
+}
+
+// CancelUpload aborts an unfinished upload and frees what it staged.
+func (h *FileHandler) CancelUpload(c *fiber.Ctx) error {
+	id, err := parseUint(c.Params("id"))
+	if err != nil { return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id")) }
+	if err := h.uploads.Cancel(middleware.UserIDFromToken(c), id); err != nil { return utils.Respond(c, err) }
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// VerifyChunks reports which chunks the server already holds, reattaching the
+// staged bytes first so the answer is correct after a restart.
 func (h *FileHandler) VerifyChunks(c *fiber.Ctx) error {
 	id, err := parseUint(c.Params("id"))
 	if err != nil { return utils.Respond(c, utils.NewError(400, "invalid id")) }
-	idx, err := h.repo.GetVerifiedChunkIndices(id)
-	if err != nil { return utils.Respond(c, utils.NewError(500, "verify")) }
-	return c.JSON(fiber.Map{"uploaded_chunks": idx, "total": len(idx)})
+	fu, idx, err := h.uploads.Resume(middleware.UserIDFromToken(c), id)
+	if err != nil { return utils.Respond(c, err) }
+	return c.JSON(fiber.Map{"uploaded_chunks": idx, "total": fu.TotalChunks})
 }
 
 // ─── Helpers ──────────────────────────────────────────────────────────────────
 
+// bodyStream returns the request body as a reader. Bodies are streamed
+// (Config.StreamRequestBody), so reading from it does not buffer the whole
+// body in memory first.
+func bodyStream(c *fiber.Ctx) io.Reader {
+	if r := c.Context().RequestBodyStream(); r != nil {
+		return r
+	}
+	return bytes.NewReader(c.Body())
+}
+
+// bodyLength is the declared Content-Length, or -1 when the body is chunked
+// or has no length.
+func bodyLength(c *fiber.Ctx) int64 {
+	return max(int64(c.Request().Header.ContentLength()), -1)
+}
+
 func parseUint(s string) (uint, error) {
 	v, err := strconv.ParseUint(s, 10, 32)
 	return uint(v), err
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"file-transfer-backend/middleware"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type JobHandler struct {
+	jobs  types.IJobRepository
+	queue types.IJobQueue
+	files types.IFileRepository
+}
+
+func NewJobHandler(jobs types.IJobRepository, queue types.IJobQueue, files types.IFileRepository) *JobHandler {
+	return &JobHandler{jobs: jobs, queue: queue, files: files}
+}
+
+// ListJobs returns the caller's 50 most recent jobs, optionally only those
+// for one upload (?file_upload_id=N).
+func (h *JobHandler) ListJobs(c *fiber.Ctx) error {
+	uid := middleware.UserIDFromToken(c)
+	var fileID *uint
+	if fid := c.Query("file_upload_id"); fid != "" {
+		id, err := parseUint(fid)
+		if err != nil {
+			return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid file_upload_id"))
+		}
+		fileID = &id
+	}
+	jobs, err := h.jobs.ListByUser(uid, fileID, 50)
+	if err != nil {
+		slog.Error("list jobs", "err", err)
+		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "list failed"))
+	}
+	return c.JSON(jobs)
+}
+
+func (h *JobHandler) GetJob(c *fiber.Ctx) error {
+	job, err := h.owned(c)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.JSON(job)
+}
+
+// RetryJob re-queues a job that has exhausted its retries.
+func (h *JobHandler) RetryJob(c *fiber.Ctx) error {
+	job, err := h.owned(c)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	if job.Status != "failed" {
+		return utils.Respond(c, utils.NewError(fiber.StatusConflict, "only failed jobs can be retried"))
+	}
+	if job.FileUploadID != nil {
+		if fu, err := h.files.GetByID(*job.FileUploadID); err == nil && fu.Status == "failed" {
+			fu.Status = "processing"
+			h.files.Update(fu)
+		}
+	}
+	if err := h.queue.Retry(job); err != nil {
+		slog.Error("retry job", "id", job.ID, "err", err)
+		return utils.Respond(c, utils.NewError(fiber.StatusInternalServerError, "retry failed"))
+	}
+	slog.Info("job re-queued", "id", job.ID, "kind", job.Kind)
+	return c.JSON(job)
+}
+
+func (h *JobHandler) owned(c *fiber.Ctx) (*models.Job, error) {
+	id, err := parseUint(c.Params("id"))
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusBadRequest, "invalid id")
+	}
+	job, err := h.jobs.GetByID(id)
+	if err != nil || job.UserID != middleware.UserIDFromToken(c) {
+		return nil, utils.NewError(fiber.StatusNotFound, "not found")
+	}
+	return job, nil
+}
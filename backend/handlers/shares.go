@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"file-transfer-backend/middleware"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ShareHandler struct {
+	shares   types.IShareService
+	archives types.IArchiveService
+	store    types.IStorage
+}
+
+func NewShareHandler(shares types.IShareService, archives types.IArchiveService, store types.IStorage) *ShareHandler {
+	return &ShareHandler{shares: shares, archives: archives, store: store}
+}
+
+// ─── Managing links ───────────────────────────────────────────────────────────
+
+// CreateShare creates a link: {file_id | folder_id, expires_at?, password?,
+// max_downloads?}. The response carries the token the public URL is built from.
+func (h *ShareHandler) CreateShare(c *fiber.Ctx) error {
+	var req types.ShareCreate
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid request body"))
+	}
+	link, err := h.shares.Create(middleware.UserIDFromToken(c), req)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(link)
+}
+
+// ListShares returns the caller's links, newest first; ?file_id=N or
+// ?folder_id=N narrows them to one item.
+func (h *ShareHandler) ListShares(c *fiber.Ctx) error {
+	fileID, err := queryID(c, "file_id")
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	folderID, err := queryID(c, "folder_id")
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	links, err := h.shares.List(middleware.UserIDFromToken(c), fileID, folderID)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.JSON(links)
+}
+
+// queryID reads an optional id from the query string.
+func queryID(c *fiber.Ctx, key string) (*uint, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	id, err := parseUint(v)
+	if err != nil {
+		return nil, utils.NewFieldError(fiber.StatusBadRequest, key, "invalid "+key)
+	}
+	return &id, nil
+}
+
+func (h *ShareHandler) RevokeShare(c *fiber.Ctx) error {
+	id, err := parseUint(c.Params("id"))
+	if err != nil {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id"))
+	}
+	if err := h.shares.Revoke(middleware.UserIDFromToken(c), id); err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ShareAccesses returns a link's most recent accesses, refused ones included.
+func (h *ShareHandler) ShareAccesses(c *fiber.Ctx) error {
+	id, err := parseUint(c.Params("id"))
+	if err != nil {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "invalid id"))
+	}
+	accesses, err := h.shares.Accesses(middleware.UserIDFromToken(c), id)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	return c.JSON(accesses)
+}
+
+// ─── Public access (no account) ───────────────────────────────────────────────
+
+// visit reads a request to /s/:token. The password comes from the
+// X-Share-Password header or, for POST, a "password" form or JSON field.
+func visit(c *fiber.Ctx, download bool) types.ShareVisit {
+	password := c.Get("X-Share-Password")
+	if password == "" && c.Method() == fiber.MethodPost {
+		var body struct {
+			Password string `json:"password" form:"password"`
+		}
+		if c.BodyParser(&body) == nil {
+			password = body.Password
+		}
+	}
+	return types.ShareVisit{
+		Token:     c.Params("token"),
+		Password:  password,
+		Download:  download,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+}
+
+// ShareInfo describes what a link points at without downloading it, for a
+// landing page. It answers 401 while a password is needed.
+func (h *ShareHandler) ShareInfo(c *fiber.Ctx) error {
+	item, err := h.shares.Open(visit(c, false))
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	info := fiber.Map{
+		"name":           item.Name,
+		"expires_at":     item.Link.ExpiresAt,
+		"downloads_left": nil,
+	}
+	if item.Link.MaxDownloads > 0 {
+		info["downloads_left"] = item.Link.MaxDownloads - item.Link.Downloads
+	}
+	if item.File != nil {
+		info["kind"]      = "file"
+		info["file_type"] = item.File.FileType
+		info["size"]      = item.File.FileSize
+		return c.JSON(info)
+	}
+	var files int
+	var size int64
+	for _, e := range item.Entries {
+		if e.File != nil {
+			files++
+			size += e.File.FileSize
+		}
+	}
+	info["kind"]  = "folder"
+	info["files"] = files
+	info["size"]  = size
+	return c.JSON(info)
+}
+
+// OpenShare downloads what a link points at: the file itself, with Range
+// support, or the folder as <name>.zip (?method=store|deflate). Every request
+// is recorded; only a full download — no Range, or one from the first byte,
+// and not a 304 — counts against max_downloads. HEAD counts nothing.
+func (h *ShareHandler) OpenShare(c *fiber.Ctx) error {
+	method, err := archiveMethod(c.Query("method"))
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	head := c.Method() == fiber.MethodHead
+	v := visit(c, !head)
+	item, err := h.shares.Open(v)
+	if err != nil {
+		return utils.Respond(c, err)
+	}
+	if item.File != nil {
+		if err := downloadable(item.File); err != nil {
+			if !head {
+				h.shares.Served(item, v, "unavailable")
+			}
+			return utils.Respond(c, err)
+		}
+		if head {
+			return serveFile(c, h.store, item.File, nil)
+		}
+		served := false
+		err := serveFile(c, h.store, item.File, func(outcome string) error {
+			served = true
+			return h.shares.Served(item, v, outcome)
+		})
+		if !served {
+			h.shares.Served(item, v, "failed")
+		}
+		return err
+	}
+
+	if head {
+		c.Set(fiber.HeaderContentType, "application/zip")
+		c.Set(fiber.HeaderContentDisposition, utils.ContentDisposition("attachment", item.Name+".zip"))
+		return nil
+	}
+	if err := h.shares.Served(item, v, "download"); err != nil {
+		return utils.Respond(c, err)
+	}
+	return streamArchive(c, h.archives, item.Link.UserID, item.Name+".zip", item.Entries, method)
+}
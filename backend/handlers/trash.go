@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"file-transfer-backend/middleware"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxTrashBatch caps how many items one batch restore may name.
+const maxTrashBatch = 1000
+
+type TrashHandler struct {
+	trash types.ITrashService
+}
+
+func NewTrashHandler(trash types.ITrashService) *TrashHandler {
+	return &TrashHandler{trash: trash}
+}
+
+// EmptyTrash permanently deletes everything in the caller's trash and
+// reports what was freed.
+func (h *TrashHandler) EmptyTrash(c *fiber.Ctx) error {
+	del, err := h.trash.Empty(middleware.UserIDFromToken(c))
+	if err != nil { return utils.Respond(c, err) }
+	return c.JSON(del)
+}
+
+// RestoreBatch restores {files: [ids], folders: [ids]}. With "folder_id"
+// present (null = root) everything is restored into that folder instead of
+// where it was. Items that cannot be restored are listed under "failed";
+// the rest are restored regardless.
+func (h *TrashHandler) RestoreBatch(c *fiber.Ctx) error {
+	var req struct {
+		Files   []uint `json:"files"`
+		Folders []uint `json:"folders"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "bad body"))
+	}
+	if len(req.Files)+len(req.Folders) == 0 {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "nothing to restore"))
+	}
+	if len(req.Files)+len(req.Folders) > maxTrashBatch {
+		return utils.Respond(c, utils.NewError(fiber.StatusBadRequest, "too many items"))
+	}
+	dest, move, err := restoreTarget(c, "folder_id")
+	if err != nil { return utils.Respond(c, err) }
+
+	return c.JSON(h.trash.RestoreBatch(middleware.UserIDFromToken(c), req.Files, req.Folders, dest, move))
+}
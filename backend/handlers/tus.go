@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"file-transfer-backend/config"
+	"file-transfer-backend/middleware"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ─── tus 1.0 resumable upload protocol ────────────────────────────────────────
+//
+// https://tus.io/protocols/resumable-upload — lets off-the-shelf clients
+// (tus-js-client, tusd-compatible CLIs) upload into the same FileUpload rows,
+// staging area and local/S3 finalization as the WebSocket path.
+//
+// Supported extensions: creation, creation-with-upload, termination, checksum,
+// expiration. Recognised Upload-Metadata keys: filename (or name), filetype
+// (or type), checksum (SHA-256 hex of the whole file), folder_id, rel_path
+// (or relativePath).
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,checksum,expiration"
+	tusChecksums  = "sha1,sha256,md5"
+	tusOctets     = "application/offset+octet-stream"
+)
+
+type TusHandler struct {
+	uploads types.IUploadService
+	repo    types.IFileRepository
+	cfg     *config.UploadConfig
+}
+
+func NewTusHandler(uploads types.IUploadService, repo types.IFileRepository, cfg *config.UploadConfig) *TusHandler {
+	return &TusHandler{uploads: uploads, repo: repo, cfg: cfg}
+}
+
+// Options advertises server capabilities. Registered outside the JWT group so
+// discovery works without a token.
+func (h *TusHandler) Options(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtensions)
+	c.Set("Tus-Checksum-Algorithm", tusChecksums)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Create implements the creation and creation-with-upload extensions.
+func (h *TusHandler) Create(c *fiber.Ctx) error {
+	if err := tusPrecondition(c); err != nil { return tusRespond(c, err) }
+	uid := middleware.UserIDFromToken(c)
+
+	if c.Get("Upload-Defer-Length") != "" {
+		return tusError(c, fiber.StatusBadRequest, "Upload-Defer-Length is not supported")
+	}
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return tusError(c, fiber.StatusBadRequest, "invalid Upload-Length")
+	}
+
+	meta := parseTusMetadata(c.Get("Upload-Metadata"))
+	req := types.UploadInit{
+		FileName: firstNonEmpty(meta["filename"], meta["name"]),
+		FileType: firstNonEmpty(meta["filetype"], meta["type"]),
+		FileSize: length,
+		Checksum: meta["checksum"],
+		RelPath:  firstNonEmpty(meta["rel_path"], meta["relativePath"]),
+	}
+	if req.FileName == "" {
+		return tusError(c, fiber.StatusBadRequest, "Upload-Metadata must include filename")
+	}
+	if fid := meta["folder_id"]; fid != "" {
+		id, err := parseUint(fid)
+		if err != nil { return tusError(c, fiber.StatusBadRequest, "invalid folder_id") }
+		req.FolderID = &id
+	}
+
+	fu, err := h.uploads.Init(uid, req)
+	if err != nil { return tusRespond(c, err) }
+
+	c.Set("Location", c.BaseURL()+"/api/tus/"+strconv.FormatUint(uint64(fu.ID), 10))
+	h.setExpires(c, fu)
+
+	// Known content (metadata checksum matched a stored blob) is complete
+	// already — report the full length so the client sends nothing
+	if fu.Status == "completed" {
+		c.Set("Upload-Offset", strconv.FormatInt(length, 10))
+		return c.SendStatus(fiber.StatusCreated)
+	}
+
+	// creation-with-upload: the POST body may already carry the first bytes
+	offset := int64(0)
+	if c.Get(fiber.HeaderContentType) == tusOctets && bodyLength(c) != 0 {
+		if offset, err = h.append(c, uid, fu, 0); err != nil { return tusRespond(c, err) }
+	}
+	c.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	if offset == length {
+		if _, err := h.uploads.CompleteStream(uid, fu.ID); err != nil { return tusRespond(c, err) }
+	}
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// Head reports how many bytes the server has for an upload.
+func (h *TusHandler) Head(c *fiber.Ctx) error {
+	if err := tusPrecondition(c); err != nil { return tusRespond(c, err) }
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	fu, offset, err := h.load(c)
+	if err != nil { return tusRespond(c, err) }
+
+	c.Set("Upload-Length", strconv.FormatInt(fu.FileSize, 10))
+	c.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if fu.Status == "pending" || fu.Status == "uploading" {
+		h.setExpires(c, fu)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Patch appends bytes at Upload-Offset and finalizes the file once the
+// declared length is reached.
+func (h *TusHandler) Patch(c *fiber.Ctx) error {
+	if err := tusPrecondition(c); err != nil { return tusRespond(c, err) }
+	if c.Get(fiber.HeaderContentType) != tusOctets {
+		return tusError(c, fiber.StatusUnsupportedMediaType, "Content-Type must be "+tusOctets)
+	}
+	uid := middleware.UserIDFromToken(c)
+
+	fu, current, err := h.load(c)
+	if err != nil { return tusRespond(c, err) }
+	if fu.Status != "pending" && fu.Status != "uploading" {
+		return tusError(c, fiber.StatusForbidden, "upload is already "+fu.Status)
+	}
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return tusError(c, fiber.StatusBadRequest, "invalid Upload-Offset")
+	}
+	if offset != current {
+		return tusError(c, fiber.StatusConflict, fmt.Sprintf("Upload-Offset %d does not match %d", offset, current))
+	}
+
+	size, err := h.append(c, uid, fu, offset)
+	if err != nil { return tusRespond(c, err) }
+	c.Set("Upload-Offset", strconv.FormatInt(size, 10))
+	h.setExpires(c, fu)
+
+	if size == fu.FileSize {
+		if _, err := h.uploads.CompleteStream(uid, fu.ID); err != nil { return tusRespond(c, err) }
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Terminate implements the termination extension for unfinished uploads.
+func (h *TusHandler) Terminate(c *fiber.Ctx) error {
+	if err := tusPrecondition(c); err != nil { return tusRespond(c, err) }
+	id, err := parseUint(c.Params("id"))
+	if err != nil { return tusError(c, fiber.StatusNotFound, "not found") }
+	if err := h.uploads.Cancel(middleware.UserIDFromToken(c), id); err != nil { return tusRespond(c, err) }
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// load resolves :id to an upload started by the caller plus its current offset.
+// Finished uploads report their full length so clients treat them as done.
+func (h *TusHandler) load(c *fiber.Ctx) (*models.FileUpload, int64, error) {
+	uid := middleware.UserIDFromToken(c)
+	id, err := parseUint(c.Params("id"))
+	if err != nil { return nil, 0, utils.NewError(fiber.StatusNotFound, "not found") }
+
+	fu, err := h.repo.GetByID(id)
+	if err != nil || (fu.UserID != uid && fu.UploaderID != uid) {
+		return nil, 0, utils.NewError(fiber.StatusNotFound, "not found")
+	}
+	if err := h.uploads.Allowed(uid, fu); err != nil { return nil, 0, err }
+	switch fu.Status {
+	case "pending", "uploading":
+	case "failed", "expired":
+		return nil, 0, utils.NewError(fiber.StatusGone, "upload is "+fu.Status)
+	default:
+		return fu, fu.FileSize, nil
+	}
+	if time.Now().After(h.expiresAt(fu)) {
+		return nil, 0, utils.NewError(fiber.StatusGone, "upload expired")
+	}
+	return h.uploads.Offset(uid, id)
+}
+
+// append streams the request body to staging at offset, enforcing
+// Upload-Length and the optional Upload-Checksum header. The body is never
+// held in memory; one that runs past Upload-Length is rolled back.
+func (h *TusHandler) append(c *fiber.Ctx, uid uint, fu *models.FileUpload, offset int64) (int64, error) {
+	left := fu.FileSize - offset
+	if bodyLength(c) > left {
+		return 0, errPastLength
+	}
+	body := &cappedReader{r: bodyStream(c), left: left}
+
+	var check hash.Hash
+	var want []byte
+	if hdr := c.Get("Upload-Checksum"); hdr != "" {
+		algo, sum, _ := strings.Cut(hdr, " ")
+		switch algo {
+		case "sha1":   check = sha1.New()
+		case "sha256": check = sha256.New()
+		case "md5":    check = md5.New()
+		default:
+			return 0, utils.NewError(fiber.StatusBadRequest, "unsupported checksum algorithm")
+		}
+		var err error
+		if want, err = base64.StdEncoding.DecodeString(sum); err != nil {
+			return 0, utils.NewError(fiber.StatusBadRequest, "invalid Upload-Checksum")
+		}
+	}
+
+	size, err := h.uploads.Append(uid, fu.ID, offset, body, check, want)
+	if body.over {
+		return size, errPastLength
+	}
+	return size, err
+}
+
+var errPastLength = utils.NewError(fiber.StatusBadRequest, "body exceeds Upload-Length")
+
+// cappedReader fails once more than left bytes are read, so a body without
+// a Content-Length still can't write past Upload-Length.
+type cappedReader struct {
+	r    io.Reader
+	left int64
+	over bool
+}
+
+func (r *cappedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.left+1 {
+		p = p[:r.left+1]
+	}
+	n, err := r.r.Read(p)
+	if int64(n) > r.left {
+		r.over = true
+		return 0, errPastLength
+	}
+	r.left -= int64(n)
+	return n, err
+}
+
+// expiresAt is when an unfinished upload stops being resumable — measured
+// from its last activity.
+func (h *TusHandler) expiresAt(fu *models.FileUpload) time.Time {
+	return fu.UpdatedAt.Add(time.Duration(h.cfg.ExpiryHours) * time.Hour)
+}
+
+func (h *TusHandler) setExpires(c *fiber.Ctx, fu *models.FileUpload) {
+	c.Set("Upload-Expires", h.expiresAt(fu).UTC().Format(http.TimeFormat))
+}
+
+// tusPrecondition enforces the Tus-Resumable header required on every
+// request except OPTIONS and stamps it on the response.
+func tusPrecondition(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	if c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return utils.NewError(fiber.StatusPreconditionFailed, "unsupported Tus-Resumable version")
+	}
+	return nil
+}
+
+func tusError(c *fiber.Ctx, code int, msg string) error {
+	return utils.Respond(c, utils.NewError(code, msg))
+}
+
+// tusRespond writes a service error, keeping its status code (e.g. 409, 460).
+func tusRespond(c *fiber.Ctx, err error) error {
+	slog.Warn("tus request failed", "path", c.Path(), "err", err)
+	return utils.Respond(c, err)
+}
+
+// parseTusMetadata decodes "key base64value,key2 base64value2,flag".
+func parseTusMetadata(header string) map[string]string {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		if dec, err := base64.StdEncoding.DecodeString(val); err == nil {
+			meta[key] = string(dec)
+		}
+	}
+	return meta
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
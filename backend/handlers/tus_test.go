@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"pairs", "filename dGVzdC50eHQ=,filetype dGV4dC9wbGFpbg==", map[string]string{"filename": "test.txt", "filetype": "text/plain"}},
+		{"spaces around pairs", " filename dGVzdA== , folder_id MTI= ", map[string]string{"filename": "test", "folder_id": "12"}},
+		{"flag without value", "filename dGVzdA==,is_confidential", map[string]string{"filename": "test", "is_confidential": ""}},
+		{"unicode", "filename 0L7RgtGH0ZHRgi5wZGY=", map[string]string{"filename": "отчёт.pdf"}},
+		{"bad base64 dropped", "filename !!!,filetype dGV4dA==", map[string]string{"filetype": "text"}},
+		{"empty pairs skipped", ",,filename dGVzdA==,", map[string]string{"filename": "test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseTusMetadata(tt.header); !maps.Equal(got, tt.want) {
+				t.Fatalf("%q: got %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCappedReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     io.Reader
+		left     int64
+		want     string
+		overflow bool
+	}{
+		{"shorter", strings.NewReader("abc"), 10, "abc", false},
+		{"exact", strings.NewReader("abcde"), 5, "abcde", false},
+		{"empty at zero", strings.NewReader(""), 0, "", false},
+		{"over in one read", strings.NewReader("abcde"), 3, "", true},
+		{"over byte by byte", iotest.OneByteReader(strings.NewReader("abcde")), 3, "abc", true},
+		{"any byte at zero", strings.NewReader("a"), 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &cappedReader{r: tt.body, left: tt.left}
+			got, err := io.ReadAll(r)
+			if string(got) != tt.want {
+				t.Fatalf("read %q, want %q", got, tt.want)
+			}
+			if r.over != tt.overflow {
+				t.Fatalf("over %v, want %v", r.over, tt.overflow)
+			}
+			if tt.overflow != errors.Is(err, errPastLength) {
+				t.Fatalf("err %v", err)
+			}
+			if !tt.overflow && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"file-transfer-backend/middleware"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type UsageHandler struct {
+	quota types.IQuotaService
+}
+
+func NewUsageHandler(quota types.IQuotaService) *UsageHandler {
+	return &UsageHandler{quota: quota}
+}
+
+// GetUsage reports the caller's quota, what is used and what is left, with
+// completed files broken down into active, starred and trashed.
+func (h *UsageHandler) GetUsage(c *fiber.Ctx) error {
+	usage, err := h.quota.Usage(middleware.UserIDFromToken(c))
+	if err != nil { return utils.Respond(c, err) }
+	return c.JSON(usage)
+}
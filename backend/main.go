@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"file-transfer-backend/config"
 	"file-transfer-backend/database"
 	"file-transfer-backend/handlers"
@@ -10,6 +11,7 @@ import (
 	"file-transfer-backend/services"
 	"log"
 	"log/slog"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -39,49 +41,87 @@ func main() {
 	userRepo   := repository.NewUserRepository(gdb)
 	fileRepo   := repository.NewFileRepository(gdb)
 	folderRepo := repository.NewFolderRepository(gdb)
+	jobRepo    := repository.NewJobRepository(gdb)
+	blobRepo   := repository.NewBlobRepository(gdb)
+	shareRepo  := repository.NewShareRepository(gdb)
+	grantRepo  := repository.NewGrantRepository(gdb)
 
 	// 6. Services
 	authSvc := services.NewAuthService(userRepo, &cfg.JWT)
 	cs      := services.NewChecksumService()
+	staging, err := services.NewStagingService(cfg.Upload.StagingDir)
+	if err != nil {
+		log.Fatalf("staging init: %v", err)
+	}
+	jobQueue := services.NewJobQueue(jobRepo, &cfg.Jobs, cfg.Upload.MaxRetries)
 
-	// 7. S3 (optional — enabled only when keys are present in .env)
-	var s3Svc *services.S3Service
-	if cfg.S3.Enabled {
-		var err error
-		s3Svc, err = services.NewS3Service(
-			cfg.S3.Region,
-			cfg.S3.AccessKeyID,
-			cfg.S3.SecretAccessKey,
-			cfg.S3.Bucket,
-		)
-		if err != nil {
-			log.Fatalf("S3 init failed: %v", err)
-		}
-		slog.Info("S3 async upload enabled",
-			"bucket", cfg.S3.Bucket,
-			"region", cfg.S3.Region,
-		)
-	} else {
-		slog.Info("S3 not configured — using local storage",
-			"dir", cfg.Upload.Directory,
-		)
+	// 7. Storage — local disk, S3 or in-memory (STORAGE_BACKEND)
+	store, err := services.NewStorage(cfg)
+	if err != nil {
+		log.Fatalf("storage init: %v", err)
 	}
+	slog.Info("storage backend ready", "backend", store.Name())
+	multipart := services.NewMultipartUploader(store, &cfg.S3) // nil unless the backend supports it
+	blobSvc   := services.NewBlobService(blobRepo, store, jobQueue)
+
+	// Quotas — used_bytes is rebuilt from file_uploads so it never drifts
+	quotaSvc := services.NewQuotaService(userRepo, fileRepo, &cfg.Upload)
+	if err := userRepo.RecalculateUsage(); err != nil {
+		slog.Error("usage recalculation failed", "err", err)
+	}
+
+	trashSvc   := services.NewTrashService(fileRepo, folderRepo, blobSvc)
+	archiveSvc := services.NewArchiveService(fileRepo, folderRepo, store)
+	copySvc    := services.NewCopyService(fileRepo, folderRepo, blobSvc, quotaSvc, store, jobQueue, jobRepo)
+	shareSvc   := services.NewShareService(shareRepo, fileRepo, folderRepo, archiveSvc)
+	permSvc    := services.NewPermissionService(grantRepo, fileRepo, folderRepo, userRepo)
 
 	// 8. Handlers
-	authHandler   := handlers.NewAuthHandler(authSvc, userRepo)
-	fileHandler   := handlers.NewFileHandler(fileRepo, &cfg.Upload, s3Svc)
-	folderHandler := handlers.NewFolderHandler(folderRepo)
-	uploadHandler := handlers.NewUploadWSHandler(fileRepo, cs, &cfg.Upload, s3Svc)
+	authHandler    := handlers.NewAuthHandler(authSvc, userRepo)
+	uploadSvc      := services.NewUploadService(fileRepo, folderRepo, cs, staging, jobQueue, &cfg.Upload, store, blobSvc, quotaSvc, permSvc, multipart)
+	fileHandler    := handlers.NewFileHandler(fileRepo, uploadSvc, &cfg.Upload, store, blobSvc, trashSvc, copySvc, permSvc)
+	folderHandler  := handlers.NewFolderHandler(folderRepo, blobSvc, trashSvc, copySvc, permSvc)
+	uploadHandler  := handlers.NewUploadWSHandler(uploadSvc)
+	tusHandler     := handlers.NewTusHandler(uploadSvc, fileRepo, &cfg.Upload)
+	jobHandler     := handlers.NewJobHandler(jobRepo, jobQueue, fileRepo)
+	usageHandler   := handlers.NewUsageHandler(quotaSvc)
+	janitor        := services.NewJanitor(fileRepo, staging, multipart, trashSvc, blobSvc, &cfg.Upload, &cfg.Janitor)
+	adminHandler   := handlers.NewAdminHandler(janitor)
+	trashHandler   := handlers.NewTrashHandler(trashSvc)
+	archiveHandler := handlers.NewArchiveHandler(archiveSvc, permSvc)
+	grantHandler   := handlers.NewGrantHandler(permSvc)
+	shareHandler   := handlers.NewShareHandler(shareSvc, archiveSvc, store)
+
+	// Job kinds are registered by the services above — start workers last
+	jobQueue.Start(context.Background())
+	janitor.Start(context.Background())
 
 	// 9. Fiber app
+	// Request bodies are streamed so REST chunks and tus PATCHes go to staging
+	// without being buffered whole; BodyLimit keeps MAX_BODY_SIZE for the rest.
 	app := fiber.New(fiber.Config{
-		BodyLimit: cfg.Server.MaxBodySize,
+		BodyLimit:         cfg.Server.MaxBodySize,
+		StreamRequestBody: true,
 	})
+	app.Use(middleware.BodyLimit(cfg.Server.MaxBodySize, func(c *fiber.Ctx) bool {
+		switch c.Method() {
+		case fiber.MethodPut:
+			return strings.HasPrefix(c.Path(), "/api/uploads/")
+		case fiber.MethodPost, fiber.MethodPatch:
+			return strings.HasPrefix(c.Path(), "/api/tus")
+		}
+		return false
+	}))
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: cfg.Server.AllowedOrigins,
-		AllowHeaders: "Origin, Content-Type, Authorization",
-		AllowMethods: "GET, POST, PATCH, DELETE",
+		AllowHeaders: "Origin, Content-Type, Authorization, X-Chunk-Checksum, X-Total-Chunks, " +
+			"Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset, Upload-Checksum, Upload-Defer-Length, " +
+			"Range, If-Range, If-None-Match, If-Modified-Since, X-Share-Password",
+		AllowMethods: "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		ExposeHeaders: "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Checksum-Algorithm, " +
+			"Upload-Offset, Upload-Length, Upload-Expires, " +
+			"Content-Disposition, Content-Range, Accept-Ranges, ETag, Last-Modified",
 	}))
 
 	// 10. Public routes
@@ -90,31 +130,83 @@ func main() {
 	auth.Post("/register", authHandler.Register)
 	auth.Post("/login",    authHandler.Login)
 
+	// Share links — the token in the URL is the credential
+	app.Get("/s/:token/info", shareHandler.ShareInfo)
+	app.Get("/s/:token",      shareHandler.OpenShare)
+	app.Post("/s/:token",     shareHandler.OpenShare)
+
+	// tus discovery — OPTIONS carries no token
+	app.Options("/api/tus",    tusHandler.Options)
+	app.Options("/api/tus/*",  tusHandler.Options)
+
 	// 11. Protected routes
 	api := app.Group("/api", middleware.JWTMiddleware(&cfg.JWT))
 
 	api.Get("/me",           authHandler.Me)
 	api.Patch("/me",         authHandler.UpdateProfile)
 	api.Post("/me/password", authHandler.ChangePassword)
+	api.Get("/me/usage",     usageHandler.GetUsage)
 
 	api.Get("/files",                fileHandler.ListFiles)
 	api.Get("/files/recent",         fileHandler.GetRecentFiles)
 	api.Get("/files/starred",        fileHandler.GetStarredFiles)
 	api.Get("/files/trash",          fileHandler.GetTrashedFiles)
+	api.Post("/files/archive",       archiveHandler.ArchiveFiles)
 	api.Get("/files/:id/download",   fileHandler.DownloadFile)
+	api.Get("/files/:id/content",    fileHandler.ServeContent)
 	api.Patch("/files/:id/move",     fileHandler.MoveFile)
+	api.Post("/files/:id/copy",      fileHandler.CopyFile)
 	api.Patch("/files/:id/star",     fileHandler.ToggleStar)
 	api.Patch("/files/:id/trash",    fileHandler.TrashFile)
 	api.Patch("/files/:id/restore",  fileHandler.RestoreFile)
+	api.Get("/files/:id/grants",     grantHandler.FileGrants)
+	api.Post("/files/:id/grants",    grantHandler.GrantFile)
+	api.Patch("/files/:id",          fileHandler.RenameFile)
 	api.Delete("/files/:id",         fileHandler.DeleteFile)
 
+	api.Post("/uploads",                  fileHandler.InitUpload)
+	api.Put("/uploads/:id/chunks/:index", fileHandler.UploadChunk)
+	api.Get("/uploads/:id/chunks",        fileHandler.VerifyChunks)
+	api.Post("/uploads/:id/complete",     fileHandler.CompleteUpload)
+	api.Delete("/uploads/:id",            fileHandler.CancelUpload)
+
+	api.Post("/tus",          tusHandler.Create)
+	api.Head("/tus/:id",      tusHandler.Head)
+	api.Patch("/tus/:id",     tusHandler.Patch)
+	api.Delete("/tus/:id",    tusHandler.Terminate)
+
+	api.Get("/jobs",             jobHandler.ListJobs)
+	api.Get("/jobs/:id",         jobHandler.GetJob)
+	api.Post("/jobs/:id/retry",  jobHandler.RetryJob)
+
+	api.Get("/shares",               shareHandler.ListShares)
+	api.Post("/shares",              shareHandler.CreateShare)
+	api.Get("/shares/:id/accesses",  shareHandler.ShareAccesses)
+	api.Delete("/shares/:id",        shareHandler.RevokeShare)
+
+	api.Get("/shared",         grantHandler.SharedWithMe)
+	api.Delete("/grants/:id",  grantHandler.RevokeGrant)
+
+	api.Delete("/trash",        trashHandler.EmptyTrash)
+	api.Post("/trash/restore",  trashHandler.RestoreBatch)
+
 	api.Get("/folders",               folderHandler.ListFolders)
 	api.Post("/folders",              folderHandler.CreateFolder)
 	api.Get("/folders/trash",         folderHandler.GetTrashedFolders)
+	api.Get("/folders/:id/archive",   archiveHandler.ArchiveFolder)
+	api.Patch("/folders/:id/move",    folderHandler.MoveFolder)
+	api.Post("/folders/:id/copy",     folderHandler.CopyFolder)
 	api.Patch("/folders/:id/trash",   folderHandler.TrashFolder)
 	api.Patch("/folders/:id/restore", folderHandler.RestoreFolder)
+	api.Get("/folders/:id/grants",    grantHandler.FolderGrants)
+	api.Post("/folders/:id/grants",   grantHandler.GrantFolder)
+	api.Patch("/folders/:id",         folderHandler.RenameFolder)
 	api.Delete("/folders/:id",        folderHandler.DeleteFolder)
 
+	admin := api.Group("/admin", middleware.AdminOnly(userRepo, cfg.Server.AdminEmails))
+	admin.Get("/janitor",      adminHandler.GetJanitor)
+	admin.Post("/janitor/run", adminHandler.RunJanitor)
+
 	// 12. WebSocket upload
 	app.Use("/ws/upload", middleware.WSJWTMiddleware(&cfg.JWT))
 	app.Get("/ws/upload", websocket.New(uploadHandler.HandleUpload))
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"file-transfer-backend/config"
+	"file-transfer-backend/types"
 	"log/slog"
 	"strings"
 	"time"
@@ -84,6 +85,28 @@ func WSUserID(locals func(key string) interface{}) uint {
 	return id
 }
 
+// AdminOnly lets through users whose email is listed in emails
+// (comma-separated, ADMIN_EMAILS). Must run after JWTMiddleware. The email is
+// read from the database, not the token, so revoking admin takes effect
+// immediately.
+func AdminOnly(users types.IUserRepository, emails string) fiber.Handler {
+	admins := map[string]bool{}
+	for _, e := range strings.Split(emails, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			admins[e] = true
+		}
+	}
+	return func(c *fiber.Ctx) error {
+		uid := UserIDFromToken(c)
+		user, err := users.FindByID(uid)
+		if err != nil || !admins[strings.ToLower(user.Email)] {
+			slog.Warn("admin access denied", "path", c.Path(), "user", uid)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+		}
+		return c.Next()
+	}
+}
+
 func GenerateToken(cfg *config.JWTConfig, userID uint, email string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
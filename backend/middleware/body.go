@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit enforces the request body limit for handlers that read their
+// body whole. The server streams request bodies (Config.StreamRequestBody)
+// so uploads go to staging without being buffered first, and fasthttp then
+// only reads the first few KB on its own — a larger body would otherwise be
+// pulled into memory by c.Body() without any limit. Routes that stream
+// their body themselves and bound it on their own are exempted by streamed.
+func BodyLimit(max int, streamed func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if streamed(c) {
+			return c.Next()
+		}
+		n := c.Request().Header.ContentLength()
+		if n > max {
+			slog.Warn("request body too large", "path", c.Path(), "ip", c.IP(), "length", n, "limit", max)
+			return tooLarge(c)
+		}
+		// Chunked bodies have no length up front: read at most max+1 bytes
+		// and hand the handler a buffered body as usual
+		if n == -1 {
+			if r := c.Context().RequestBodyStream(); r != nil {
+				body, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+				if err != nil {
+					c.Context().SetConnectionClose()
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "could not read request body"})
+				}
+				if len(body) > max {
+					slog.Warn("chunked request body too large", "path", c.Path(), "ip", c.IP(), "limit", max)
+					return tooLarge(c)
+				}
+				c.Request().SetBody(body)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// tooLarge rejects the body and closes the connection: the rest of the body
+// is still unread and must not be parsed as the next request.
+func tooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "request body too large"})
+}
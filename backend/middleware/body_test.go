@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestBodyLimit(t *testing.T) {
+	const max = 16
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"under the limit", "/echo", strings.Repeat("a", 10), false, 200},
+		{"at the limit", "/echo", strings.Repeat("a", max), false, 200},
+		{"over the limit", "/echo", strings.Repeat("a", max+1), false, 413},
+		{"chunked under the limit", "/echo", strings.Repeat("a", 10), true, 200},
+		{"chunked at the limit", "/echo", strings.Repeat("a", max), true, 200},
+		{"chunked over the limit", "/echo", strings.Repeat("a", 64<<10), true, 413},
+		{"empty", "/echo", "", false, 200},
+		{"streamed route over the limit", "/stream", strings.Repeat("a", 64<<10), false, 200},
+		{"streamed route chunked", "/stream", strings.Repeat("a", 64<<10), true, 200},
+	}
+	client := bodyLimitServer(t, max)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = io.MultiReader(body) // hides the length: sent chunked
+			}
+			resp, err := client.Post("http://test"+tt.path, "text/plain", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d (%s)", resp.StatusCode, tt.status, got)
+			}
+			if tt.path == "/echo" && tt.status == http.StatusOK && string(got) != tt.body {
+				t.Fatalf("handler saw %d bytes, want %d", len(got), len(tt.body))
+			}
+		})
+	}
+}
+
+// bodyLimitServer serves an app with BodyLimit over an in-memory listener.
+// app.Test writes a Content-Length header for every body, so chunked
+// requests need a real connection.
+func bodyLimitServer(t *testing.T, max int) *http.Client {
+	t.Helper()
+	app := fiber.New(fiber.Config{BodyLimit: max, StreamRequestBody: true, DisableStartupMessage: true})
+	app.Use(BodyLimit(max, func(c *fiber.Ctx) bool { return c.Path() == "/stream" }))
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	app.Post("/stream", func(c *fiber.Ctx) error {
+		n, err := io.Copy(io.Discard, c.Context().RequestBodyStream())
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"read": n})
+	})
+
+	ln := fasthttputil.NewInmemoryListener()
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return ln.Dial()
+		},
+	}}
+}
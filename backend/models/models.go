@@ -7,56 +7,147 @@ import (
 )
 
 type User struct {
-	ID        uint           `gorm:"primarykey"           json:"id"`
-	Name      string         `gorm:"not null"             json:"name"`
-	Email     string         `gorm:"uniqueIndex;not null" json:"email"`
-	Password  string         `gorm:"not null"             json:"-"`
-	AvatarURL string         `gorm:"default:''"          json:"avatar_url"`
-	CreatedAt time.Time      `                            json:"created_at"`
-	UpdatedAt time.Time      `                            json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index"                json:"-"`
+	ID         uint           `gorm:"primarykey"           json:"id"`
+	Name       string         `gorm:"not null"             json:"name"`
+	Email      string         `gorm:"uniqueIndex;not null" json:"email"`
+	Password   string         `gorm:"not null"             json:"-"`
+	AvatarURL  string         `gorm:"default:''"          json:"avatar_url"`
+	QuotaBytes int64          `gorm:"default:0"            json:"quota_bytes"` // 0 = configured default, -1 = unlimited
+	UsedBytes  int64          `gorm:"<-:false;default:0"   json:"used_bytes"`  // maintained by SQL increments only
+	CreatedAt  time.Time      `                            json:"created_at"`
+	UpdatedAt  time.Time      `                            json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index"                json:"-"`
 }
 
+// Trash: an item trashed by the user has TrashRootID nil. Items taken down
+// because a folder above them was trashed point TrashRootID at that folder,
+// so restoring it brings back exactly those.
 type Folder struct {
-	ID        uint           `gorm:"primarykey"          json:"id"`
-	UserID    uint           `gorm:"not null;index"      json:"user_id"`
-	ParentID  *uint          `gorm:"index"               json:"parent_id"`
-	Name      string         `gorm:"not null"            json:"name"`
-	Trashed   bool           `gorm:"default:false"       json:"trashed"`
-	CreatedAt time.Time      `                           json:"created_at"`
-	UpdatedAt time.Time      `                           json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index"               json:"-"`
+	ID          uint           `gorm:"primarykey"          json:"id"`
+	UserID      uint           `gorm:"not null;index"      json:"user_id"`
+	ParentID    *uint          `gorm:"index"               json:"parent_id"`
+	Name        string         `gorm:"not null"            json:"name"`
+	Trashed     bool           `gorm:"default:false"       json:"trashed"`
+	TrashedAt   *time.Time     `                           json:"trashed_at"`
+	TrashRootID *uint          `gorm:"index"               json:"trash_root_id"` // folder whose trashing took this one down
+	CreatedAt   time.Time      `                           json:"created_at"`
+	UpdatedAt   time.Time      `                           json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index"               json:"-"`
 }
 
 type FileUpload struct {
-	ID          uint           `gorm:"primarykey"              json:"id"`
-	UserID      uint           `gorm:"not null;index"          json:"user_id"`
-	FolderID    *uint          `gorm:"index"                   json:"folder_id"`
-	FileName    string         `gorm:"not null"                json:"file_name"`
-	FileType    string         `                               json:"file_type"`
-	FileSize    int64          `                               json:"file_size"`
-	TotalChunks int            `                               json:"total_chunks"`
-	Checksum    string         `                               json:"checksum"`
-	Status      string         `gorm:"default:'pending'"       json:"status"`
-	FilePath    string         `                               json:"file_path"`
-	RelPath     string         `gorm:"default:''"             json:"rel_path"` // folder upload relative path
-	Starred     bool           `gorm:"default:false"           json:"starred"`
-	Trashed     bool           `gorm:"default:false"           json:"trashed"`
-	CreatedAt   time.Time      `                               json:"created_at"`
-	UpdatedAt   time.Time      `                               json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index"                   json:"-"`
+	ID           uint           `gorm:"primarykey"              json:"id"`
+	UserID       uint           `gorm:"not null;index"          json:"user_id"`
+	UploaderID   uint           `                               json:"uploader_id"` // who started the upload; the owner unless uploaded into a shared folder
+	FolderID     *uint          `gorm:"index"                   json:"folder_id"`
+	FileName     string         `gorm:"not null"                json:"file_name"`
+	FileType     string         `                               json:"file_type"`
+	FileSize     int64          `                               json:"file_size"`
+	TotalChunks  int            `                               json:"total_chunks"`
+	Checksum     string         `                               json:"checksum"`
+	Status       string         `gorm:"default:'pending'"       json:"status"`
+	FilePath     string         `                               json:"file_path"`
+	RelPath      string         `gorm:"default:''"             json:"rel_path"` // folder upload relative path
+	MultipartID  string         `gorm:"default:''"             json:"-"` // storage multipart upload in progress
+	MultipartKey string         `gorm:"default:''"             json:"-"` // key the multipart upload targets
+	BlobID       *uint          `gorm:"index"                   json:"-"` // stored content; nil for files stored before dedup
+	Starred      bool           `gorm:"default:false"           json:"starred"`
+	Trashed      bool           `gorm:"default:false"           json:"trashed"`
+	TrashedAt    *time.Time     `                               json:"trashed_at"`
+	TrashRootID  *uint          `gorm:"index"                   json:"trash_root_id"` // folder whose trashing took this file down
+	CreatedAt    time.Time      `                               json:"created_at"`
+	UpdatedAt    time.Time      `                               json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index"                   json:"-"`
 }
 
 // FileChunk kept for backward compat / verify endpoint
 type FileChunk struct {
-	ID           uint           `gorm:"primarykey"        json:"id"`
-	FileUploadID uint           `gorm:"not null;index"    json:"file_upload_id"`
-	ChunkIndex   int            `                         json:"chunk_index"`
-	ChunkSize    int            `                         json:"chunk_size"`
-	Checksum     string         `                         json:"checksum"`
-	Status       string         `gorm:"default:'pending'" json:"status"`
-	Data         []byte         `                         json:"-"`
-	CreatedAt    time.Time      `                         json:"created_at"`
-	UpdatedAt    time.Time      `                         json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index"             json:"-"`
+	ID           uint           `gorm:"primarykey"                             json:"id"`
+	FileUploadID uint           `gorm:"not null;uniqueIndex:idx_chunk_upload" json:"file_upload_id"`
+	ChunkIndex   int            `gorm:"uniqueIndex:idx_chunk_upload"          json:"chunk_index"` // one row per index
+	ChunkSize    int            `                                              json:"chunk_size"`
+	Checksum     string         `                                              json:"checksum"`
+	Status       string         `gorm:"default:'pending'"                      json:"status"`
+	Data         []byte         `                                              json:"-"`
+	CreatedAt    time.Time      `                                              json:"created_at"`
+	UpdatedAt    time.Time      `                                              json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index"                                  json:"-"`
+}
+
+// Job is a unit of durable background work (e.g. pushing a staged upload to
+// S3). Rows survive restarts: anything left "running" by a dead process is
+// re-queued at startup and retried with exponential backoff.
+type Job struct {
+	ID           uint      `gorm:"primarykey"                json:"id"`
+	UserID       uint      `gorm:"not null;index"            json:"user_id"`
+	Kind         string    `gorm:"not null;index"            json:"kind"`
+	Status       string    `gorm:"default:'queued';index"    json:"status"` // queued → running → done | failed
+	FileUploadID *uint     `gorm:"index"                     json:"file_upload_id"`
+	Payload      string    `gorm:"type:text"                 json:"-"`
+	Attempts     int       `gorm:"default:0"                 json:"attempts"`
+	MaxAttempts  int       `gorm:"default:1"                 json:"max_attempts"`
+	NextRunAt    time.Time `gorm:"index"                     json:"next_run_at"`
+	LastError    string    `gorm:"type:text"                 json:"last_error"`
+	Progress     int       `gorm:"default:0"                 json:"progress"` // items done, for jobs that report it
+	Total        int       `gorm:"default:0"                 json:"total"`
+	Lease        string    `gorm:"default:''"                json:"-"` // token of the run holding the job while running
+	CreatedAt    time.Time `                                 json:"created_at"`
+	UpdatedAt    time.Time `                                 json:"updated_at"`
+}
+
+// ShareLink is a public link to one file or folder (exactly one of
+// FileUploadID / FolderID is set). Anyone with the token can download it
+// until the link is revoked, expires or has served MaxDownloads downloads.
+type ShareLink struct {
+	ID           uint       `gorm:"primarykey"           json:"id"`
+	UserID       uint       `gorm:"not null;index"       json:"user_id"`
+	Token        string     `gorm:"not null;uniqueIndex" json:"token"`
+	FileUploadID *uint      `gorm:"index"                json:"file_upload_id"`
+	FolderID     *uint      `gorm:"index"                json:"folder_id"`
+	Password     string     `gorm:"default:''"           json:"-"` // bcrypt hash; '' = no password
+	HasPassword  bool       `gorm:"-"                    json:"has_password"`
+	ExpiresAt    *time.Time `                            json:"expires_at"`
+	MaxDownloads int        `gorm:"default:0"            json:"max_downloads"` // 0 = unlimited
+	Downloads    int        `gorm:"default:0"            json:"downloads"`
+	RevokedAt    *time.Time `                            json:"revoked_at"`
+	CreatedAt    time.Time  `                            json:"created_at"`
+	UpdatedAt    time.Time  `                            json:"updated_at"`
+}
+
+// ShareAccess records one request made with a share link, whether or not
+// it was let through.
+type ShareAccess struct {
+	ID          uint      `gorm:"primarykey"     json:"id"`
+	ShareLinkID uint      `gorm:"not null;index" json:"share_link_id"`
+	Outcome     string    `gorm:"not null"       json:"outcome"` // info, download, partial, not_modified, unavailable, failed, password_required, wrong_password, revoked, expired, exhausted, gone
+	IP          string    `                      json:"ip"`
+	UserAgent   string    `                      json:"user_agent"`
+	CreatedAt   time.Time `                      json:"created_at"`
+}
+
+// Grant gives another user a role on a file or folder (exactly one of
+// FileUploadID / FolderID is set). A folder grant covers everything below
+// it. Role is "viewer", "commenter" or "editor".
+type Grant struct {
+	ID           uint      `gorm:"primarykey"                                                       json:"id"`
+	OwnerID      uint      `gorm:"not null;index"                                                   json:"owner_id"`
+	UserID       uint      `gorm:"not null;uniqueIndex:idx_grant_file;uniqueIndex:idx_grant_folder" json:"user_id"`
+	FileUploadID *uint     `gorm:"uniqueIndex:idx_grant_file"                                       json:"file_upload_id"`
+	FolderID     *uint     `gorm:"uniqueIndex:idx_grant_folder"                                     json:"folder_id"`
+	Role         string    `gorm:"not null"                                                         json:"role"`
+	CreatedAt    time.Time `                                                                        json:"created_at"`
+	UpdatedAt    time.Time `                                                                        json:"updated_at"`
+}
+
+// Blob is one stored copy of some content, shared by every FileUpload with
+// the same SHA-256 and size. The bytes are deleted from storage only when
+// RefCount drops to zero.
+type Blob struct {
+	ID        uint      `gorm:"primarykey"                            json:"id"`
+	Checksum  string    `gorm:"not null;uniqueIndex:idx_blob_content" json:"checksum"`
+	Size      int64     `gorm:"not null;uniqueIndex:idx_blob_content" json:"size"`
+	Key       string    `gorm:"not null"                              json:"key"`
+	RefCount  int       `gorm:"not null;default:0"                    json:"ref_count"`
+	CreatedAt time.Time `                                             json:"created_at"`
+	UpdatedAt time.Time `                                             json:"updated_at"`
 }
\ No newline at end of file
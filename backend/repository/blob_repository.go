@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BlobRepository struct{ db *gorm.DB }
+
+func NewBlobRepository(db *gorm.DB) types.IBlobRepository {
+	return &BlobRepository{db: db}
+}
+
+// Acquire takes a reference on the blob holding this content. The row lock
+// serializes it against Release, so a blob that is being dropped is never
+// handed out. Returns gorm.ErrRecordNotFound for unknown content.
+func (r *BlobRepository) Acquire(checksum string, size int64) (*models.Blob, error) {
+	return r.acquire(checksum, size, nil)
+}
+
+// AcquireOwned is Acquire limited to content one of userID's own files
+// already references.
+func (r *BlobRepository) AcquireOwned(userID uint, checksum string, size int64) (*models.Blob, error) {
+	return r.acquire(checksum, size, &userID)
+}
+
+func (r *BlobRepository) acquire(checksum string, size int64, owner *uint) (*models.Blob, error) {
+	var b models.Blob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		q := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("checksum = ? AND size = ?", checksum, size)
+		if owner != nil {
+			q = q.Where("EXISTS (SELECT 1 FROM file_uploads WHERE blob_id = blobs.id AND user_id = ? AND deleted_at IS NULL)", *owner)
+		}
+		if err := q.First(&b).Error; err != nil {
+			return err
+		}
+		b.RefCount++
+		return tx.Model(&b).Update("ref_count", b.RefCount).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// CreateOrAcquire records a newly stored blob with one reference. If the
+// same content was committed concurrently, that blob is referenced instead
+// and created is false — the caller then owns a duplicate object.
+func (r *BlobRepository) CreateOrAcquire(b *models.Blob) (*models.Blob, bool, error) {
+	b.RefCount = 1
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(b).Error
+	if err != nil {
+		return nil, false, err
+	}
+	if b.ID != 0 {
+		return b, true, nil
+	}
+	existing, err := r.Acquire(b.Checksum, b.Size)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Lost a race with the last Release — try once more from scratch
+		b.ID = 0
+		if err := r.db.Create(b).Error; err != nil {
+			return nil, false, err
+		}
+		return b, true, nil
+	}
+	return existing, false, err
+}
+
+// Release drops one reference. When it was the last one the row is deleted
+// and gone is true; the caller must then delete the stored bytes.
+func (r *BlobRepository) Release(id uint) (*models.Blob, bool, error) {
+	var b models.Blob
+	gone := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&b, id).Error; err != nil {
+			return err
+		}
+		if b.RefCount <= 1 {
+			gone = true
+			return tx.Delete(&b).Error
+		}
+		return tx.Model(&b).Update("ref_count", b.RefCount-1).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &b, gone, nil
+}
@@ -1,10 +1,15 @@
 package repository
 
 import (
+	"errors"
 	"file-transfer-backend/models"
 	"file-transfer-backend/types"
+	"fmt"
+	"sort"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FileRepository struct{ db *gorm.DB }
@@ -19,8 +24,8 @@ func (r *FileRepository) Create(f *models.FileUpload) error {
 
 func (r *FileRepository) GetByID(id uint) (*models.FileUpload, error) {
 	var f models.FileUpload
-	// No Preload("Chunks") — chunks are held in-memory during WS upload,
-	// not persisted to file_chunks anymore.
+	// No Preload("Chunks") — chunk bytes live in the staging dir; file_chunks
+	// only records which indices were accepted (for resume).
 	err := r.db.First(&f, id).Error
 	return &f, err
 }
@@ -33,8 +38,210 @@ func (r *FileRepository) UpdateFolderID(id uint, folderID *uint) error {
 	return r.db.Exec("UPDATE file_uploads SET folder_id = ? WHERE id = ?", folderID, id).Error
 }
 
-func (r *FileRepository) UpdateTrashed(id uint, trashed bool) error {
-	return r.db.Exec("UPDATE file_uploads SET trashed = ? WHERE id = ?", trashed, id).Error
+// Trash puts a file in the trash on its own account (no trash_root_id).
+func (r *FileRepository) Trash(id uint) error {
+	return r.db.Exec(
+		"UPDATE file_uploads SET trashed = true, trashed_at = NOW(), trash_root_id = NULL WHERE id = ? AND trashed = false", id,
+	).Error
+}
+
+// Restore takes a file out of the trash, moving it to folderID when move is set.
+func (r *FileRepository) Restore(id uint, folderID *uint, move bool) error {
+	updates := map[string]any{"trashed": false, "trashed_at": nil, "trash_root_id": nil}
+	if move {
+		updates["folder_id"] = folderID
+	}
+	return r.db.Model(&models.FileUpload{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Rename gives a file a new name among the completed, live files of its
+// folder (see resolveName). A replaced sibling goes to the trash on its own
+// account. The caller checks that the file is the user's and not trashed.
+func (r *FileRepository) Rename(id, userID uint, name string, conflict types.NameConflict) (*types.Renamed, error) {
+	res := &types.Renamed{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockNames(tx, userID); err != nil {
+			return err
+		}
+		var f models.FileUpload
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&f).Error; err != nil {
+			return err
+		}
+		siblings := func() *gorm.DB {
+			q := tx.Model(&models.FileUpload{}).
+				Where("user_id = ? AND trashed = false AND status IN ('completed', 'processing') AND id <> ?", userID, id)
+			return inParent(q, "folder_id", f.FolderID)
+		}
+
+		var err error
+		if res.Name, res.Replaced, err = resolveName(siblings, "file_name", name, true, conflict); err != nil {
+			return err
+		}
+		if err := trashFiles(tx, res.Replaced); err != nil {
+			return err
+		}
+		return tx.Model(&f).Update("file_name", res.Name).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// trashFiles puts files in the trash on their own account, as Trash does.
+func trashFiles(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Exec(
+		"UPDATE file_uploads SET trashed = true, trashed_at = NOW(), trash_root_id = NULL WHERE id IN ?", ids,
+	).Error
+}
+
+// Copy copies a completed, live file of the user into folderID (nil = root),
+// resolving a name clash there as for Rename (see copyFiles). The caller
+// checks that folderID is the user's and live.
+func (r *FileRepository) Copy(id, userID uint, folderID *uint, conflict types.NameConflict, limit func(quotaBytes int64) int64) (*types.Copy, error) {
+	cp := &types.Copy{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockNames(tx, userID); err != nil {
+			return err
+		}
+		var f models.FileUpload
+		if err := tx.Where("id = ? AND user_id = ? AND status = 'completed' AND trashed = false", id, userID).First(&f).Error; err != nil {
+			return err
+		}
+		siblings := func() *gorm.DB {
+			q := tx.Model(&models.FileUpload{}).
+				Where("user_id = ? AND trashed = false AND status IN ('completed', 'processing')", userID)
+			return inParent(q, "folder_id", folderID)
+		}
+
+		name, replaced, err := resolveName(siblings, "file_name", f.FileName, true, conflict)
+		if err != nil {
+			return err
+		}
+		if err := trashFiles(tx, replaced); err != nil {
+			return err
+		}
+		f.FileName = name
+		copies, err := copyFiles(tx, userID, []models.FileUpload{f}, func(models.FileUpload) *uint { return folderID }, limit, cp)
+		if err != nil {
+			return err
+		}
+		cp.File = &copies[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// copyFiles inserts copies of files for userID inside tx, each into
+// folderOf(f) (nil = root), and adds them to cp:
+//
+//  0. the copies' total size must fit the quota, checked under a lock on the
+//     user as for CreateReserved — *types.QuotaExceeded otherwise
+//  1. a copy of deduplicated content takes another reference on its blob and
+//     is completed at once — blobs are locked in id order, as in deleteFiles
+//  2. a copy of a file stored before dedup starts out "processing" without
+//     content and is listed in cp.Pending for a job to copy its bytes
+//  3. the owner's used_bytes is raised by the completed copies' sizes
+func copyFiles(tx *gorm.DB, userID uint, files []models.FileUpload, folderOf func(models.FileUpload) *uint, limit func(int64) int64, cp *types.Copy) ([]models.FileUpload, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var size int64
+	for _, f := range files {
+		size += f.FileSize
+	}
+	if err := reserve(tx, userID, size, limit); err != nil {
+		return nil, err
+	}
+
+	var bytes int64
+	copies := make([]models.FileUpload, len(files))
+	refs   := map[uint]int{}
+	for i, f := range files {
+		c := models.FileUpload{
+			UserID:      userID,
+			FolderID:    folderOf(f),
+			FileName:    f.FileName,
+			FileType:    f.FileType,
+			FileSize:    f.FileSize,
+			TotalChunks: f.TotalChunks,
+			Checksum:    f.Checksum,
+			RelPath:     f.RelPath,
+			Status:      "processing",
+		}
+		if f.BlobID != nil {
+			c.Status   = "completed"
+			c.BlobID   = f.BlobID
+			c.FilePath = f.FilePath
+			refs[*f.BlobID]++
+			bytes += f.FileSize
+		}
+		copies[i] = c
+		cp.Bytes += f.FileSize
+	}
+
+	blobIDs := make([]uint, 0, len(refs))
+	for bid := range refs {
+		blobIDs = append(blobIDs, bid)
+	}
+	sort.Slice(blobIDs, func(i, j int) bool { return blobIDs[i] < blobIDs[j] })
+	for _, bid := range blobIDs {
+		res := tx.Exec("UPDATE blobs SET ref_count = ref_count + ? WHERE id = ?", refs[bid], bid)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, fmt.Errorf("blob %d was deleted during the copy", bid)
+		}
+	}
+
+	if err := tx.CreateInBatches(copies, 500).Error; err != nil {
+		return nil, err
+	}
+	for i, c := range copies {
+		if c.BlobID == nil {
+			cp.Pending = append(cp.Pending, types.CopyObject{FileID: c.ID, Src: files[i].FilePath})
+		}
+	}
+	if err := tx.Exec("UPDATE users SET used_bytes = used_bytes + ? WHERE id = ?", bytes, userID).Error; err != nil {
+		return nil, err
+	}
+	cp.Files += len(copies)
+	return copies, nil
+}
+
+// CompleteCopy points a copy whose bytes were just stored at their blob and
+// counts it towards its owner's usage. A copy is "processing", or "failed"
+// when its job gave up before a retry. It reports false when the copy is
+// gone or already done, and the caller must drop the blob reference.
+func (r *FileRepository) CompleteCopy(id uint, blob *models.Blob) (bool, error) {
+	done := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var f models.FileUpload
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status IN ('processing', 'failed') AND blob_id IS NULL", id).
+			First(&f).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&f).Updates(map[string]any{
+			"status": "completed", "blob_id": blob.ID, "file_path": blob.Key, "checksum": blob.Checksum,
+		}).Error; err != nil {
+			return err
+		}
+		done = true
+		return tx.Exec("UPDATE users SET used_bytes = used_bytes + ? WHERE id = ?", f.FileSize, f.UserID).Error
+	})
+	return done, err
 }
 
 func (r *FileRepository) Delete(id, userID uint) error {
@@ -44,9 +251,194 @@ func (r *FileRepository) Delete(id, userID uint) error {
 	return r.db.Exec("DELETE FROM file_uploads WHERE id = ? AND user_id = ?", id, userID).Error
 }
 
+// DeleteFiles permanently removes the given files of a user in one
+// transaction (see deleteFiles). Ids that are not the user's are skipped.
+func (r *FileRepository) DeleteFiles(userID uint, ids []uint) (*types.Deletion, error) {
+	del := &types.Deletion{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var files []models.FileUpload
+		if err := tx.Where("id IN ? AND user_id = ?", ids, userID).Find(&files).Error; err != nil {
+			return err
+		}
+		return deleteFiles(tx, userID, files, del)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return del, nil
+}
+
+// deleteFiles removes file rows inside tx and records in del what storage
+// has to drop once tx commits:
+//
+//  1. each file drops its blob reference — a blob whose last reference goes
+//     is deleted and its key returned for removal from storage
+//  2. files stored before dedup own their object, which is returned as is;
+//     unfinished multipart uploads are returned to be aborted
+//  3. chunk and file rows are deleted, with the share links, grants and jobs
+//     of the files
+//  4. the owner's used_bytes is lowered by the completed files' sizes
+func deleteFiles(tx *gorm.DB, userID uint, files []models.FileUpload, del *types.Deletion) error {
+	if len(files) == 0 {
+		return nil
+	}
+	var bytes int64
+	ids  := make([]uint, 0, len(files))
+	refs := map[uint]int{}
+	for _, f := range files {
+		ids = append(ids, f.ID)
+		switch {
+		case f.BlobID != nil:
+			refs[*f.BlobID]++
+		case f.Status == "completed" && f.FilePath != "":
+			del.Objects     = append(del.Objects, types.ObjectRef{Key: f.FilePath})
+			del.StoredBytes += f.FileSize
+		case f.MultipartID != "":
+			del.Objects = append(del.Objects, types.ObjectRef{Key: f.MultipartKey, UploadID: f.MultipartID, FileID: f.ID})
+		}
+		if f.Status == "completed" {
+			bytes += f.FileSize
+		}
+	}
+
+	// Lock blobs in id order so concurrent deletes cannot deadlock
+	blobIDs := make([]uint, 0, len(refs))
+	for bid := range refs {
+		blobIDs = append(blobIDs, bid)
+	}
+	sort.Slice(blobIDs, func(i, j int) bool { return blobIDs[i] < blobIDs[j] })
+	for _, bid := range blobIDs {
+		var b models.Blob
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&b, bid).Error; err != nil {
+			return err
+		}
+		if b.RefCount > refs[bid] {
+			if err := tx.Model(&b).Update("ref_count", b.RefCount-refs[bid]).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Delete(&b).Error; err != nil {
+			return err
+		}
+		del.Objects     = append(del.Objects, types.ObjectRef{Key: b.Key})
+		del.StoredBytes += b.Size
+	}
+
+	if err := tx.Exec("DELETE FROM file_chunks WHERE file_upload_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := deleteShareLinks(tx, "file_upload_id", ids); err != nil {
+		return err
+	}
+	if err := deleteGrants(tx, "file_upload_id", ids); err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM jobs WHERE file_upload_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM file_uploads WHERE id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(
+		"UPDATE users SET used_bytes = GREATEST(used_bytes - ?, 0) WHERE id = ?", bytes, userID,
+	).Error; err != nil {
+		return err
+	}
+	del.Files += len(files)
+	del.Bytes += bytes
+	return nil
+}
+
+// InFlightBytes sums the declared size of uploads that are not counted in
+// used_bytes yet but will be once they complete.
+func (r *FileRepository) InFlightBytes(userID uint) (int64, error) {
+	return inFlightBytes(r.db, userID)
+}
+
+func inFlightBytes(db *gorm.DB, userID uint) (int64, error) {
+	var n int64
+	err := db.Model(&models.FileUpload{}).
+		Where("user_id = ? AND status IN ?", userID, []string{"pending", "uploading", "processing"}).
+		Select("COALESCE(SUM(file_size), 0)").Scan(&n).Error
+	return n, err
+}
+
+// CreateReserved checks f's size against the owner's quota (see reserve)
+// and inserts f, all in one transaction: a second init for the same user
+// waits for the first to commit and then counts its row. A file created
+// completed (deduplicated) is added to used_bytes in the same transaction.
+// Returns *types.QuotaExceeded when f does not fit.
+func (r *FileRepository) CreateReserved(f *models.FileUpload, limit func(quotaBytes int64) int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := reserve(tx, f.UserID, f.FileSize, limit); err != nil {
+			return err
+		}
+		if err := tx.Create(f).Error; err != nil {
+			return err
+		}
+		if f.Status != "completed" {
+			return nil
+		}
+		return tx.Exec("UPDATE users SET used_bytes = used_bytes + ? WHERE id = ?", f.FileSize, f.UserID).Error
+	})
+}
+
+// reserve locks the user's row until tx ends and checks used_bytes plus the
+// in-flight bytes plus size against the quota limit resolves (-1 = none).
+// Returns *types.QuotaExceeded when size does not fit.
+func reserve(tx *gorm.DB, userID uint, size int64, limit func(quotaBytes int64) int64) error {
+	var u models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&u, userID).Error; err != nil {
+		return err
+	}
+	quota := limit(u.QuotaBytes)
+	if quota < 0 {
+		return nil
+	}
+	inFlight, err := inFlightBytes(tx, userID)
+	if err != nil {
+		return err
+	}
+	if u.UsedBytes+inFlight+size > quota {
+		return &types.QuotaExceeded{Used: u.UsedBytes, InFlight: inFlight, Quota: quota}
+	}
+	return nil
+}
+
+// UsageByUser splits a user's completed files into disjoint trashed,
+// starred (not trashed) and active (neither) buckets.
+func (r *FileRepository) UsageByUser(userID uint) (*types.Usage, error) {
+	var rows []struct {
+		Bucket string
+		Files  int64
+		Bytes  int64
+	}
+	err := r.db.Raw(`
+		SELECT CASE WHEN trashed THEN 'trashed' WHEN starred THEN 'starred' ELSE 'active' END AS bucket,
+		       COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes
+		FROM file_uploads
+		WHERE user_id = ? AND status = 'completed' AND deleted_at IS NULL
+		GROUP BY bucket`, userID).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	u := &types.Usage{}
+	for _, row := range rows {
+		b := types.UsageBucket{Files: row.Files, Bytes: row.Bytes}
+		switch row.Bucket {
+		case "trashed": u.Trashed = b
+		case "starred": u.Starred = b
+		default:        u.Active = b
+		}
+	}
+	return u, nil
+}
+
 func (r *FileRepository) ListByFolder(userID uint, folderID *uint) ([]models.FileUpload, error) {
 	var files []models.FileUpload
-	q := r.db.Where("user_id = ? AND status = 'completed' AND trashed = false", userID)
+	// Inside a trashed folder, list what it took down with it (see ListByParent)
+	q := r.db.Where("user_id = ? AND status = 'completed' AND (trashed = false OR trash_root_id IS NOT NULL)", userID)
 	if folderID == nil {
 		q = q.Where("folder_id IS NULL")
 	} else {
@@ -56,6 +448,24 @@ func (r *FileRepository) ListByFolder(userID uint, folderID *uint) ([]models.Fil
 	return files, err
 }
 
+// ListInFolders returns the user's completed, live files in any of folderIDs.
+func (r *FileRepository) ListInFolders(userID uint, folderIDs []uint) ([]models.FileUpload, error) {
+	var files []models.FileUpload
+	err := r.db.Where("user_id = ? AND folder_id IN ? AND status = 'completed' AND trashed = false", userID, folderIDs).
+		Order("id").
+		Find(&files).Error
+	return files, err
+}
+
+// ListByIDs returns those of ids that are completed, live files of the user.
+func (r *FileRepository) ListByIDs(userID uint, ids []uint) ([]models.FileUpload, error) {
+	var files []models.FileUpload
+	err := r.db.Where("user_id = ? AND id IN ? AND status = 'completed' AND trashed = false", userID, ids).
+		Order("id").
+		Find(&files).Error
+	return files, err
+}
+
 func (r *FileRepository) ListRecent(userID uint, limit int) ([]models.FileUpload, error) {
 	var files []models.FileUpload
 	err := r.db.Where("user_id = ? AND status = 'completed' AND trashed = false", userID).
@@ -75,18 +485,32 @@ func (r *FileRepository) ListStarred(userID uint) ([]models.FileUpload, error) {
 
 func (r *FileRepository) ListTrashed(userID uint) ([]models.FileUpload, error) {
 	var files []models.FileUpload
-	err := r.db.Where("user_id = ? AND trashed = true", userID).
-		Order("updated_at DESC").
+	err := r.db.Where("user_id = ? AND trashed = true AND trash_root_id IS NULL", userID).
+		Order("trashed_at DESC").
+		Find(&files).Error
+	return files, err
+}
+
+// ListTrashedBefore returns, across all users, the files trashed directly
+// before the given time (see FolderRepository.ListTrashedBefore).
+func (r *FileRepository) ListTrashedBefore(before time.Time) ([]models.FileUpload, error) {
+	var files []models.FileUpload
+	err := r.db.Where("trashed = true AND trash_root_id IS NULL AND COALESCE(trashed_at, updated_at) < ?", before).
 		Find(&files).Error
 	return files, err
 }
 
-// The following chunk methods are kept to satisfy the IFileRepository interface
-// and support the /upload/verify/:id endpoint. They are not used by the WS
-// upload path (which holds chunks in memory).
+// Chunk rows are bookkeeping only: one "verified" row per accepted chunk with
+// its size and checksum, so an interrupted upload can be resumed. The bytes
+// themselves live in the staging dir (Data stays empty).
 
+// CreateChunk records an accepted chunk. A row for the same index already
+// there wins, so a chunk sent twice, even concurrently, is recorded once.
 func (r *FileRepository) CreateChunk(ch *models.FileChunk) error {
-	return r.db.Create(ch).Error
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_upload_id"}, {Name: "chunk_index"}},
+		DoNothing: true,
+	}).Create(ch).Error
 }
 
 func (r *FileRepository) GetChunk(fileID uint, index int) (*models.FileChunk, error) {
@@ -117,4 +541,104 @@ func (r *FileRepository) GetVerifiedChunkIndices(fileID uint) ([]int, error) {
 		idx[i] = ch.ChunkIndex
 	}
 	return idx, err
-}
\ No newline at end of file
+}
+// DeleteChunks removes the given chunk rows, or all of them when no indices
+// are passed.
+func (r *FileRepository) DeleteChunks(fileID uint, indices ...int) error {
+	if len(indices) == 0 {
+		return r.db.Exec("DELETE FROM file_chunks WHERE file_upload_id = ?", fileID).Error
+	}
+	return r.db.Exec(
+		"DELETE FROM file_chunks WHERE file_upload_id = ? AND chunk_index IN ?",
+		fileID, indices,
+	).Error
+}
+
+// MarkUploading moves an upload that still accepts chunks to "uploading"
+// with total chunks. It reports false when the upload was completed,
+// cancelled or expired in the meantime; the row is then left alone.
+func (r *FileRepository) MarkUploading(id uint, total int) (bool, error) {
+	res := r.db.Exec(
+		"UPDATE file_uploads SET status = 'uploading', total_chunks = ?, updated_at = NOW() WHERE id = ? AND status IN ('pending', 'uploading')",
+		total, id,
+	)
+	return res.RowsAffected > 0, res.Error
+}
+
+// Touch records activity on an upload without rewriting the whole row.
+func (r *FileRepository) Touch(id uint) error {
+	return r.db.Exec("UPDATE file_uploads SET updated_at = NOW() WHERE id = ?", id).Error
+}
+
+// ─── Janitor ──────────────────────────────────────────────────────────────────
+
+// ExpireStale marks uploads with no activity since before as "expired" and
+// returns them. The update is a single statement, so concurrent janitors on
+// several instances never expire the same upload twice.
+func (r *FileRepository) ExpireStale(before time.Time) ([]models.FileUpload, error) {
+	var files []models.FileUpload
+	err := r.db.Raw(`
+		UPDATE file_uploads SET status = 'expired', updated_at = NOW()
+		WHERE status IN ('pending', 'uploading') AND updated_at < ?
+		RETURNING *`, before).Scan(&files).Error
+	return files, err
+}
+
+// PurgeDead permanently deletes failed and expired uploads last touched
+// before before in one transaction, the same way as DeleteFiles (see
+// deleteFiles). Rows another instance is purging are skipped. Returns, per
+// owner, what storage still has to drop: multipart uploads a failed upload
+// never aborted, and content whose last reference went with the rows.
+func (r *FileRepository) PurgeDead(before time.Time) (map[uint]*types.Deletion, error) {
+	dead := map[uint]*types.Deletion{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var files []models.FileUpload
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ('failed', 'expired') AND updated_at < ?", before).
+			Order("user_id, id").Find(&files).Error; err != nil {
+			return err
+		}
+		byUser := map[uint][]models.FileUpload{}
+		var users []uint
+		for _, f := range files {
+			if _, ok := byUser[f.UserID]; !ok {
+				users = append(users, f.UserID)
+			}
+			byUser[f.UserID] = append(byUser[f.UserID], f)
+		}
+		for _, uid := range users {
+			dead[uid] = &types.Deletion{}
+			if err := deleteFiles(tx, uid, byUser[uid], dead[uid]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dead, nil
+}
+
+// DeleteOrphanChunks removes file_chunks rows of uploads that no longer
+// accept chunks (finished, failed, expired or deleted).
+func (r *FileRepository) DeleteOrphanChunks() (int64, error) {
+	res := r.db.Exec(`
+		DELETE FROM file_chunks WHERE file_upload_id NOT IN (
+			SELECT id FROM file_uploads WHERE status IN ('pending', 'uploading')
+		)`)
+	return res.RowsAffected, res.Error
+}
+
+// Unfinished returns the ids whose uploads may still need their staged
+// bytes: in flight, waiting for storage, or failed (kept for a manual retry).
+func (r *FileRepository) Unfinished(ids []uint) ([]uint, error) {
+	var keep []uint
+	if len(ids) == 0 {
+		return keep, nil
+	}
+	err := r.db.Model(&models.FileUpload{}).
+		Where("id IN ? AND status IN ?", ids, []string{"pending", "uploading", "processing", "failed"}).
+		Pluck("id", &keep).Error
+	return keep, err
+}
@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"errors"
 	"file-transfer-backend/models"
 	"file-transfer-backend/types"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -23,9 +25,55 @@ func (r *FolderRepository) GetByID(id, userID uint) (*models.Folder, error) {
 	return &f, err
 }
 
+func (r *FolderRepository) Find(id uint) (*models.Folder, error) {
+	var f models.Folder
+	err := r.db.First(&f, id).Error
+	return &f, err
+}
+
+// folderLockSpace namespaces the per-user advisory locks taken by EnsurePath
+// (first key of the two-key pg_advisory_xact_lock form).
+const folderLockSpace = 0x466f6c64 // "Fold"
+
+// EnsurePath walks names below parentID (nil = root), creating every folder
+// that does not exist yet, and returns the id of the last one. Trashed
+// folders are not reused. A per-user advisory lock serializes concurrent
+// calls so parallel uploads of one directory never create duplicates.
+// The caller checks that parentID belongs to the user.
+func (r *FolderRepository) EnsurePath(userID uint, parentID *uint, names []string) (*uint, error) {
+	if len(names) == 0 {
+		return parentID, nil
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockNames(tx, userID); err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			q := inParent(tx.Where("user_id = ? AND name = ? AND trashed = false", userID, name), "parent_id", parentID)
+			var f models.Folder
+			err := q.Order("id").First(&f).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				f = models.Folder{UserID: userID, ParentID: parentID, Name: name}
+				err = tx.Create(&f).Error
+			}
+			if err != nil {
+				return err
+			}
+			id := f.ID
+			parentID = &id
+		}
+		return nil
+	})
+	return parentID, err
+}
+
+// ListByParent lists a folder's children. Inside a trashed folder these are
+// the children it took down with it — the only trashed rows that have a
+// TrashRootID — so the same filter serves live and trashed folders.
 func (r *FolderRepository) ListByParent(userID uint, parentID *uint) ([]models.Folder, error) {
 	var folders []models.Folder
-	q := r.db.Where("user_id = ? AND trashed = false", userID)
+	q := r.db.Where("user_id = ? AND (trashed = false OR trash_root_id IS NOT NULL)", userID)
 	if parentID == nil {
 		q = q.Where("parent_id IS NULL")
 	} else {
@@ -35,45 +83,349 @@ func (r *FolderRepository) ListByParent(userID uint, parentID *uint) ([]models.F
 	return folders, err
 }
 
+// ListTrashed returns the folders the user trashed directly; whatever they
+// took down is reached by browsing into them.
 func (r *FolderRepository) ListTrashed(userID uint) ([]models.Folder, error) {
 	var folders []models.Folder
-	err := r.db.Where("user_id = ? AND trashed = true", userID).
-		Order("updated_at DESC").
+	err := r.db.Where("user_id = ? AND trashed = true AND trash_root_id IS NULL", userID).
+		Order("trashed_at DESC").
 		Find(&folders).Error
 	return folders, err
 }
 
-func (r *FolderRepository) UpdateTrashed(id, userID uint, trashed bool) error {
-	return r.db.Exec(
-		"UPDATE folders SET trashed = ? WHERE id = ? AND user_id = ?",
-		trashed, id, userID,
-	).Error
+// subtree returns the ids of a user's folder and every folder below it, or
+// nothing when the folder is not the user's.
+func subtree(tx *gorm.DB, id, userID uint) ([]uint, error) {
+	var ids []uint
+	err := tx.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM folders WHERE id = ? AND user_id = ?
+			UNION ALL
+			SELECT f.id FROM folders f JOIN tree t ON f.parent_id = t.id
+		)
+		SELECT id FROM tree`, id, userID).Scan(&ids).Error
+	return ids, err
 }
 
-// Delete permanently removes a folder and all files inside it.
-// The FK constraint "fk_folders_files" on file_uploads.folder_id requires we
-// delete (or nullify) child file_uploads rows before deleting the folder row.
-func (r *FolderRepository) Delete(id, userID uint) error {
+// TrashTree trashes a folder and takes down everything below it that is not
+// in the trash already, pointing it at the folder via trash_root_id.
+// Subfolders and files the user trashed earlier keep their own cause.
+func (r *FolderRepository) TrashTree(id, userID uint) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
-		// 1. Delete chunks that belong to files in this folder
+		return trashTree(tx, id, userID)
+	})
+}
+
+func trashTree(tx *gorm.DB, id, userID uint) error {
+	ids, err := subtree(tx, id, userID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	now := time.Now()
+	if err := tx.Exec(`
+		UPDATE folders SET trashed = true, trashed_at = ?, trash_root_id = ?
+		WHERE id IN ? AND id <> ? AND trashed = false`, now, id, ids, id).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`
+		UPDATE file_uploads SET trashed = true, trashed_at = ?, trash_root_id = ?
+		WHERE folder_id IN ? AND trashed = false`, now, id, ids).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`
+		UPDATE folders SET trashed = true, trashed_at = ?, trash_root_id = NULL
+		WHERE id = ?`, now, id).Error
+}
+
+// RestoreTree takes a folder out of the trash together with exactly what
+// went down with it: items trashed because of this folder, or — when the
+// folder itself was taken down by an ancestor — because of that ancestor.
+// With move set the folder is re-parented to parentID (nil = root).
+func (r *FolderRepository) RestoreTree(id, userID uint, parentID *uint, move bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var f models.Folder
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&f).Error; err != nil {
+			return err
+		}
+		ids, err := subtree(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		causes := []uint{id}
+		if f.TrashRootID != nil {
+			causes = append(causes, *f.TrashRootID)
+		}
+
+		if err := tx.Exec(`
+			UPDATE folders SET trashed = false, trashed_at = NULL, trash_root_id = NULL
+			WHERE id IN ? AND trash_root_id IN ?`, ids, causes).Error; err != nil {
+			return err
+		}
 		if err := tx.Exec(`
-			DELETE FROM file_chunks
-			WHERE file_upload_id IN (
-				SELECT id FROM file_uploads WHERE folder_id = ?
-			)`, id).Error; err != nil {
+			UPDATE file_uploads SET trashed = false, trashed_at = NULL, trash_root_id = NULL
+			WHERE folder_id IN ? AND trash_root_id IN ?`, ids, causes).Error; err != nil {
 			return err
 		}
+		updates := map[string]any{"trashed": false, "trashed_at": nil, "trash_root_id": nil}
+		if move {
+			updates["parent_id"] = parentID
+		}
+		return tx.Model(&f).Updates(updates).Error
+	})
+}
 
-		// 2. Delete files inside the folder
-		if err := tx.Exec(
-			"DELETE FROM file_uploads WHERE folder_id = ?", id,
-		).Error; err != nil {
+// Rename gives a folder a new name among the live folders next to it. A
+// replaced sibling is trashed with its subtree, as if trashed by the user.
+// The caller checks that the folder exists and is not in the trash.
+func (r *FolderRepository) Rename(id, userID uint, name string, conflict types.NameConflict) (*types.Renamed, error) {
+	res := &types.Renamed{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockNames(tx, userID); err != nil {
 			return err
 		}
+		var f models.Folder
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&f).Error; err != nil {
+			return err
+		}
+		siblings := func() *gorm.DB {
+			q := tx.Model(&models.Folder{}).Where("user_id = ? AND trashed = false AND id <> ?", userID, id)
+			return inParent(q, "parent_id", f.ParentID)
+		}
 
-		// 3. Delete the folder itself (owned by this user)
-		return tx.Exec(
-			"DELETE FROM folders WHERE id = ? AND user_id = ?", id, userID,
-		).Error
+		var err error
+		if res.Name, res.Replaced, err = resolveName(siblings, "name", name, false, conflict); err != nil {
+			return err
+		}
+		for _, sid := range res.Replaced {
+			if err := trashTree(tx, sid, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&f).Update("name", res.Name).Error
 	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Move re-parents a folder under parentID (nil = root). The check that the
+// destination is not the folder itself or one of its descendants runs under
+// the names lock, so two concurrent moves can't build a loop between them
+// (ErrFolderCycle). A name clash at the destination is resolved as for
+// Rename. The caller checks that the destination is the user's and live.
+//
+// Stored objects keep their keys: blob keys carry no folder ids, and keys of
+// files stored before dedup only the id of the file's own folder, which a
+// move never changes.
+func (r *FolderRepository) Move(id, userID uint, parentID *uint, conflict types.NameConflict) (*types.Renamed, error) {
+	res := &types.Renamed{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockNames(tx, userID); err != nil {
+			return err
+		}
+		var f models.Folder
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&f).Error; err != nil {
+			return err
+		}
+		if parentID != nil {
+			ids, err := subtree(tx, id, userID)
+			if err != nil {
+				return err
+			}
+			for _, d := range ids {
+				if d == *parentID {
+					return types.ErrFolderCycle
+				}
+			}
+		}
+		siblings := func() *gorm.DB {
+			q := tx.Model(&models.Folder{}).Where("user_id = ? AND trashed = false AND id <> ?", userID, id)
+			return inParent(q, "parent_id", parentID)
+		}
+
+		var err error
+		if res.Name, res.Replaced, err = resolveName(siblings, "name", f.Name, false, conflict); err != nil {
+			return err
+		}
+		for _, sid := range res.Replaced {
+			if err := trashTree(tx, sid, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&f).Updates(map[string]any{"parent_id": parentID, "name": res.Name}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// liveTree selects a live folder of the user and its live descendants as
+// "tree" (id, parent_id, name, depth). Trashed subfolders are left out with
+// everything below them.
+const liveTree = `
+	WITH RECURSIVE tree AS (
+		SELECT id, parent_id, name, 0 AS depth FROM folders
+		WHERE id = ? AND user_id = ? AND trashed = false
+		UNION ALL
+		SELECT f.id, f.parent_id, f.name, t.depth + 1 FROM folders f
+		JOIN tree t ON f.parent_id = t.id
+		WHERE f.trashed = false
+	)`
+
+// liveFolders returns a live folder of the user and its live descendants,
+// parents before children; nothing when the folder is not the user's or
+// trashed.
+func liveFolders(tx *gorm.DB, id, userID uint) ([]models.Folder, error) {
+	var tree []models.Folder
+	err := tx.Raw(liveTree+" SELECT id, parent_id, name FROM tree ORDER BY depth, id", id, userID).
+		Scan(&tree).Error
+	return tree, err
+}
+
+// Tree returns a live folder and its live subfolders, parents first. Only
+// id, parent_id and name are loaded.
+func (r *FolderRepository) Tree(id, userID uint) ([]models.Folder, error) {
+	return liveFolders(r.db, id, userID)
+}
+
+// TreeSize sums the completed, live files a copy of the folder would hold.
+func (r *FolderRepository) TreeSize(id, userID uint) (int64, error) {
+	var n int64
+	err := r.db.Raw(liveTree+`
+		SELECT COALESCE(SUM(file_size), 0) FROM file_uploads
+		WHERE folder_id IN (SELECT id FROM tree) AND trashed = false AND status = 'completed'`, id, userID).
+		Scan(&n).Error
+	return n, err
+}
+
+// CopyTree copies a live folder with its live subfolders and completed files
+// into parentID (nil = root). The copy's name is resolved against the
+// folders there as for Rename; the folders below keep theirs. Files are
+// copied with copyFiles. Everything happens in one transaction — only the
+// bytes of files stored before dedup are left to a job (cp.Pending). The
+// caller checks that parentID is the user's and live.
+func (r *FolderRepository) CopyTree(id, userID uint, parentID *uint, conflict types.NameConflict, limit func(quotaBytes int64) int64) (*types.Copy, error) {
+	cp := &types.Copy{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockNames(tx, userID); err != nil {
+			return err
+		}
+		tree, err := liveFolders(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		if len(tree) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		ids := make([]uint, len(tree))
+		for i, f := range tree {
+			ids[i] = f.ID
+		}
+		// Read before a replaced sibling — possibly the folder itself — is trashed
+		var files []models.FileUpload
+		if err := tx.Where("folder_id IN ? AND trashed = false AND status = 'completed'", ids).
+			Order("id").Find(&files).Error; err != nil {
+			return err
+		}
+
+		siblings := func() *gorm.DB {
+			q := tx.Model(&models.Folder{}).Where("user_id = ? AND trashed = false", userID)
+			return inParent(q, "parent_id", parentID)
+		}
+		name, replaced, err := resolveName(siblings, "name", tree[0].Name, false, conflict)
+		if err != nil {
+			return err
+		}
+		for _, sid := range replaced {
+			if err := trashTree(tx, sid, userID); err != nil {
+				return err
+			}
+		}
+
+		// Parents come first, so every new parent id is known in time
+		newIDs := make(map[uint]uint, len(tree))
+		for i, f := range tree {
+			c := models.Folder{UserID: userID, Name: f.Name, ParentID: parentID}
+			if i == 0 {
+				c.Name = name
+			} else {
+				pid := newIDs[*f.ParentID]
+				c.ParentID = &pid
+			}
+			if err := tx.Create(&c).Error; err != nil {
+				return err
+			}
+			newIDs[f.ID] = c.ID
+			if i == 0 {
+				cp.Folder = &c
+			}
+		}
+		cp.Folders = len(tree)
+
+		_, err = copyFiles(tx, userID, files, func(f models.FileUpload) *uint {
+			fid := newIDs[*f.FolderID]
+			return &fid
+		}, limit, cp)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// DeleteTree permanently removes a folder with every subfolder and file
+// below it, in one transaction: the subtree is collected with a recursive
+// CTE, its files are removed with deleteFiles, then the share links and
+// grants on its folders and the folder rows (after the files: the "fk_folders_files"
+// constraint on file_uploads.folder_id).
+//
+// Storage is only touched after commit, by the caller, using the returned
+// Objects. Nothing is deleted (Folders == 0) when the folder is not the user's.
+func (r *FolderRepository) DeleteTree(id, userID uint) (*types.Deletion, error) {
+	del := &types.Deletion{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		folderIDs, err := subtree(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		if len(folderIDs) == 0 {
+			return nil
+		}
+
+		var files []models.FileUpload
+		if err := tx.Where("folder_id IN ?", folderIDs).Find(&files).Error; err != nil {
+			return err
+		}
+		if err := deleteFiles(tx, userID, files, del); err != nil {
+			return err
+		}
+		if err := deleteShareLinks(tx, "folder_id", folderIDs); err != nil {
+			return err
+		}
+		if err := deleteGrants(tx, "folder_id", folderIDs); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM folders WHERE id IN ?", folderIDs).Error; err != nil {
+			return err
+		}
+		del.Folders = len(folderIDs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return del, nil
+}
+
+// ListTrashedBefore returns, across all users, the folders trashed directly
+// before the given time. Rows trashed before trashed_at existed count from
+// their last update.
+func (r *FolderRepository) ListTrashedBefore(before time.Time) ([]models.Folder, error) {
+	var folders []models.Folder
+	err := r.db.Where("trashed = true AND trash_root_id IS NULL AND COALESCE(trashed_at, updated_at) < ?", before).
+		Find(&folders).Error
+	return folders, err
 }
\ No newline at end of file
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GrantRepository struct{ db *gorm.DB }
+
+func NewGrantRepository(db *gorm.DB) types.IGrantRepository {
+	return &GrantRepository{db: db}
+}
+
+// Upsert relies on the unique (user_id, file_upload_id) and
+// (user_id, folder_id) indexes; the column left NULL never conflicts.
+func (r *GrantRepository) Upsert(g *models.Grant) error {
+	target := []clause.Column{{Name: "user_id"}, {Name: "folder_id"}}
+	if g.FileUploadID != nil {
+		target = []clause.Column{{Name: "user_id"}, {Name: "file_upload_id"}}
+	}
+	g.UpdatedAt = time.Now()
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   target,
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(g).Error
+}
+
+func (r *GrantRepository) GetByID(id uint) (*models.Grant, error) {
+	var g models.Grant
+	err := r.db.First(&g, id).Error
+	return &g, err
+}
+
+func (r *GrantRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Grant{}, id).Error
+}
+
+func (r *GrantRepository) ListForItem(fileID, folderID *uint) ([]types.GrantEntry, error) {
+	var grants []types.GrantEntry
+	q := r.db.Table("grants").
+		Select("grants.*, users.email, users.name").
+		Joins("JOIN users ON users.id = grants.user_id")
+	if fileID != nil {
+		q = q.Where("grants.file_upload_id = ?", *fileID)
+	} else {
+		q = q.Where("grants.folder_id = ?", *folderID)
+	}
+	err := q.Order("grants.created_at").Scan(&grants).Error
+	return grants, err
+}
+
+// RolesOn walks from folderID up to the root; a grant anywhere on that path
+// covers the item.
+func (r *GrantRepository) RolesOn(userID, fileID, folderID uint) ([]types.Role, error) {
+	var roles []types.Role
+	err := r.db.Raw(`
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id FROM folders WHERE id = ?
+			UNION ALL
+			SELECT f.id, f.parent_id FROM folders f
+			JOIN up ON f.id = up.parent_id
+		)
+		SELECT role FROM grants
+		WHERE user_id = ? AND (file_upload_id = ? OR folder_id IN (SELECT id FROM up))`,
+		folderID, userID, fileID).Scan(&roles).Error
+	return roles, err
+}
+
+// SharedWith leaves out items in the trash and files that aren't finished.
+func (r *GrantRepository) SharedWith(userID uint) (*types.SharedWithMe, error) {
+	shared := &types.SharedWithMe{Files: []types.SharedFile{}, Folders: []types.SharedFolder{}}
+	err := r.db.Table("grants").
+		Select("file_uploads.*, grants.id AS grant_id, grants.role, users.name AS owner_name, users.email AS owner_email").
+		Joins("JOIN file_uploads ON file_uploads.id = grants.file_upload_id").
+		Joins("JOIN users ON users.id = grants.owner_id").
+		Where("grants.user_id = ? AND file_uploads.deleted_at IS NULL", userID).
+		Where("file_uploads.trashed = false AND file_uploads.status = 'completed'").
+		Order("grants.created_at DESC").
+		Scan(&shared.Files).Error
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Table("grants").
+		Select("folders.*, grants.id AS grant_id, grants.role, users.name AS owner_name, users.email AS owner_email").
+		Joins("JOIN folders ON folders.id = grants.folder_id").
+		Joins("JOIN users ON users.id = grants.owner_id").
+		Where("grants.user_id = ? AND folders.deleted_at IS NULL AND folders.trashed = false", userID).
+		Order("grants.created_at DESC").
+		Scan(&shared.Folders).Error
+	return shared, err
+}
+
+// deleteGrants removes, inside tx, the grants on items being deleted for
+// good; col is "file_upload_id" or "folder_id".
+func deleteGrants(tx *gorm.DB, col string, ids []uint) error {
+	return tx.Where(col+" IN ?", ids).Delete(&models.Grant{}).Error
+}
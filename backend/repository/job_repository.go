@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type JobRepository struct{ db *gorm.DB }
+
+func NewJobRepository(db *gorm.DB) types.IJobRepository {
+	return &JobRepository{db: db}
+}
+
+func (r *JobRepository) Create(j *models.Job) error {
+	return r.db.Create(j).Error
+}
+
+func (r *JobRepository) GetByID(id uint) (*models.Job, error) {
+	var j models.Job
+	err := r.db.First(&j, id).Error
+	return &j, err
+}
+
+func (r *JobRepository) Update(j *models.Job) error {
+	return r.db.Save(j).Error
+}
+
+func (r *JobRepository) ListByUser(userID uint, fileUploadID *uint, limit int) ([]models.Job, error) {
+	var jobs []models.Job
+	q := r.db.Where("user_id = ?", userID)
+	if fileUploadID != nil {
+		q = q.Where("file_upload_id = ?", *fileUploadID)
+	}
+	err := q.Order("created_at DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimNext atomically picks the oldest due job, marks it running and bumps
+// its attempt counter. SKIP LOCKED lets several workers (or several server
+// instances) poll the same table without handing out a job twice.
+// The job is leased to the caller: only lease can renew or finish this run.
+// Returns nil, nil when nothing is due.
+func (r *JobRepository) ClaimNext(now time.Time, lease string) (*models.Job, error) {
+	var j models.Job
+	err := r.db.Raw(`
+		UPDATE jobs SET status = 'running', attempts = attempts + 1, updated_at = ?, lease = ?
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'queued' AND next_run_at <= ?
+			ORDER BY next_run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, now, lease, now).Scan(&j).Error
+	if err != nil {
+		return nil, err
+	}
+	if j.ID == 0 {
+		return nil, nil
+	}
+	return &j, nil
+}
+
+// Heartbeat bumps updated_at, the lease of a running job, while its worker
+// is alive. It reports false once the job was re-queued and lease is void.
+func (r *JobRepository) Heartbeat(id uint, lease string, now time.Time) (bool, error) {
+	res := r.db.Exec("UPDATE jobs SET updated_at = ? WHERE id = ? AND status = 'running' AND lease = ?", now, id, lease)
+	return res.RowsAffected > 0, res.Error
+}
+
+// Finish records how a run ended — status, attempts, error, next run time,
+// payload and progress — only while the run still holds the job's lease. A
+// worker whose lease expired, and whose job was re-queued and maybe claimed
+// by another run, gets false and leaves the row alone.
+func (r *JobRepository) Finish(j *models.Job) (bool, error) {
+	res := r.db.Model(&models.Job{}).
+		Where("id = ? AND status = 'running' AND lease = ?", j.ID, j.Lease).
+		Updates(map[string]any{
+			"status":      j.Status,
+			"last_error":  j.LastError,
+			"next_run_at": j.NextRunAt,
+			"payload":     j.Payload,
+			"progress":    j.Progress,
+			"lease":       "",
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// RequeueExpired puts running jobs whose lease ran out before before back in
+// the queue: their worker died (crash, restart, lost instance). Jobs that
+// peers are still running keep heartbeating and are left alone.
+func (r *JobRepository) RequeueExpired(before time.Time) (int64, error) {
+	res := r.db.Exec(
+		"UPDATE jobs SET status = 'queued', next_run_at = ?, lease = '' WHERE status = 'running' AND updated_at < ?", time.Now(), before,
+	)
+	return res.RowsAffected, res.Error
+}
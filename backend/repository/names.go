@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ── Sibling names ─────────────────────────────────────────
+//
+// Names are unique among the live (not trashed) files of a folder and,
+// separately, among its live subfolders. Nothing in the schema enforces
+// this — uploads may still land next to a file of the same name — but every
+// rename goes through resolveName under the per-user names lock.
+
+// lockNames serializes everything that picks a name in the user's tree for
+// the rest of the transaction (EnsurePath, renames).
+func lockNames(tx *gorm.DB, userID uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", folderLockSpace, int32(userID)).Error
+}
+
+// inParent narrows q to rows whose col is parentID (nil = root).
+func inParent(q *gorm.DB, col string, parentID *uint) *gorm.DB {
+	if parentID == nil {
+		return q.Where(col + " IS NULL")
+	}
+	return q.Where(col+" = ?", *parentID)
+}
+
+// resolveName applies a conflict policy to name. siblings returns a fresh
+// query over the rows the name must not clash with; col is their name column
+// and ext whether names keep an extension after a " (n)" suffix. It returns
+// the name to use and, for ConflictReplace, the ids of the siblings to trash.
+func resolveName(siblings func() *gorm.DB, col, name string, ext bool, conflict types.NameConflict) (string, []uint, error) {
+	var ids []uint
+	if err := siblings().Where(col+" = ?", name).Pluck("id", &ids).Error; err != nil {
+		return "", nil, err
+	}
+	if len(ids) == 0 {
+		return name, nil, nil
+	}
+
+	switch conflict {
+	case types.ConflictReplace:
+		return name, ids, nil
+	case types.ConflictRename:
+		stem, extension := utils.SplitNumbered(name, ext)
+		var names []string
+		if err := siblings().Where(col+" LIKE ?", escapeLike(stem)+"%").Pluck(col, &names).Error; err != nil {
+			return "", nil, err
+		}
+		taken := make(map[string]bool, len(names))
+		for _, n := range names {
+			taken[n] = true
+		}
+		for n := 1; ; n++ {
+			if c := utils.NumberedName(stem, extension, n); !taken[c] {
+				return c, nil, nil
+			}
+		}
+	default:
+		return "", nil, types.ErrNameTaken
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string { return likeEscaper.Replace(s) }
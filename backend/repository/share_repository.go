@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ShareRepository struct{ db *gorm.DB }
+
+func NewShareRepository(db *gorm.DB) types.IShareRepository {
+	return &ShareRepository{db: db}
+}
+
+func (r *ShareRepository) Create(l *models.ShareLink) error {
+	return r.db.Create(l).Error
+}
+
+func (r *ShareRepository) GetByID(id uint) (*models.ShareLink, error) {
+	var l models.ShareLink
+	err := r.db.First(&l, id).Error
+	return &l, err
+}
+
+func (r *ShareRepository) GetByToken(token string) (*models.ShareLink, error) {
+	var l models.ShareLink
+	err := r.db.Where("token = ?", token).First(&l).Error
+	return &l, err
+}
+
+func (r *ShareRepository) ListByUser(userID uint, fileID, folderID *uint) ([]models.ShareLink, error) {
+	var links []models.ShareLink
+	q := r.db.Where("user_id = ?", userID)
+	if fileID != nil {
+		q = q.Where("file_upload_id = ?", *fileID)
+	}
+	if folderID != nil {
+		q = q.Where("folder_id = ?", *folderID)
+	}
+	err := q.Order("created_at DESC").Find(&links).Error
+	return links, err
+}
+
+func (r *ShareRepository) Revoke(id uint, at time.Time) error {
+	return r.db.Model(&models.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+// CountDownload re-checks the link in the same statement that counts the
+// download, so concurrent requests can't take it past MaxDownloads.
+func (r *ShareRepository) CountDownload(id uint, now time.Time) (bool, error) {
+	res := r.db.Model(&models.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_downloads = 0 OR downloads < max_downloads").
+		UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *ShareRepository) LogAccess(a *models.ShareAccess) error {
+	return r.db.Create(a).Error
+}
+
+func (r *ShareRepository) ListAccesses(linkID uint, limit int) ([]models.ShareAccess, error) {
+	var accesses []models.ShareAccess
+	err := r.db.Where("share_link_id = ?", linkID).Order("created_at DESC").Limit(limit).Find(&accesses).Error
+	return accesses, err
+}
+
+// deleteShareLinks removes, inside tx, the links to items being deleted for
+// good along with their access logs; col is "file_upload_id" or "folder_id".
+func deleteShareLinks(tx *gorm.DB, col string, ids []uint) error {
+	links := tx.Model(&models.ShareLink{}).Select("id").Where(col+" IN ?", ids)
+	if err := tx.Where("share_link_id IN (?)", links).Delete(&models.ShareAccess{}).Error; err != nil {
+		return err
+	}
+	return tx.Where(col+" IN ?", ids).Delete(&models.ShareLink{}).Error
+}
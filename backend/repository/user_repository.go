@@ -31,4 +31,20 @@ func (r *UserRepository) FindByID(id uint) (*models.User, error) {
 
 func (r *UserRepository) Update(u *models.User) error {
 	return r.db.Save(u).Error
+}
+
+// AddUsage adjusts a user's stored-bytes counter in place, so concurrent
+// uploads and deletes never overwrite each other.
+func (r *UserRepository) AddUsage(id uint, delta int64) error {
+	return r.db.Exec("UPDATE users SET used_bytes = GREATEST(used_bytes + ?, 0) WHERE id = ?", delta, id).Error
+}
+
+// RecalculateUsage rebuilds every counter from the completed files. Run at
+// startup to backfill new columns and correct any drift.
+func (r *UserRepository) RecalculateUsage() error {
+	return r.db.Exec(`
+		UPDATE users SET used_bytes = (
+			SELECT COALESCE(SUM(file_size), 0) FROM file_uploads
+			WHERE user_id = users.id AND status = 'completed' AND deleted_at IS NULL
+		)`).Error
 }
\ No newline at end of file
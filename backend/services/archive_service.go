@@ -0,0 +1,209 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ── ArchiveService ────────────────────────────────────────
+//
+// Builds ZIP downloads on the fly. Entries are listed up front from the
+// database; the bytes are then read object by object from storage and
+// copied straight into the response, so no file is ever held in memory or
+// on disk. Trashed and unfinished files are never included.
+//
+// Entry paths come from names that were normalized on the way in; rows
+// older than that normalization are checked again here, and two entries
+// never share a path — the later one is numbered like a copy.
+
+type ArchiveService struct {
+	files   types.IFileRepository
+	folders types.IFolderRepository
+	store   types.IStorage
+}
+
+func NewArchiveService(files types.IFileRepository, folders types.IFolderRepository, store types.IStorage) types.IArchiveService {
+	return &ArchiveService{files: files, folders: folders, store: store}
+}
+
+func (s *ArchiveService) Folder(uid, id uint) (string, []types.ArchiveEntry, error) {
+	tree, err := s.folders.Tree(id, uid)
+	if err != nil {
+		slog.Error("archive: folder tree failed", "id", id, "err", err)
+		return "", nil, utils.NewError(fiber.StatusInternalServerError, "archive failed")
+	}
+	if len(tree) == 0 {
+		return "", nil, utils.NewError(fiber.StatusNotFound, "folder not found")
+	}
+
+	paths := newEntryPaths()
+	dirs  := make(map[uint]string, len(tree))
+	ids   := make([]uint, len(tree))
+	var entries []types.ArchiveEntry
+	for i, f := range tree {
+		name := safeName(f.Name, fmt.Sprintf("folder-%d", f.ID))
+		dir  := name
+		if i > 0 {
+			dir = dirs[*f.ParentID] + "/" + name
+		}
+		dirs[f.ID] = dir
+		ids[i]     = f.ID
+		if paths.addDir(dir) {
+			entries = append(entries, types.ArchiveEntry{Path: dir})
+		}
+	}
+
+	files, err := s.files.ListInFolders(uid, ids)
+	if err != nil {
+		slog.Error("archive: file list failed", "id", id, "err", err)
+		return "", nil, utils.NewError(fiber.StatusInternalServerError, "archive failed")
+	}
+	for i := range files {
+		f := &files[i]
+		p := paths.addFile(dirs[*f.FolderID] + "/" + safeName(f.FileName, fmt.Sprintf("file-%d", f.ID)))
+		entries = append(entries, types.ArchiveEntry{Path: p, File: f})
+	}
+	return dirs[id], entries, nil
+}
+
+func (s *ArchiveService) Files(uid uint, ids []uint) ([]types.ArchiveEntry, error) {
+	files, err := s.files.ListByIDs(uid, ids)
+	if err != nil {
+		slog.Error("archive: file list failed", "user", uid, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "archive failed")
+	}
+	if len(files) == 0 {
+		return nil, utils.NewError(fiber.StatusNotFound, "no downloadable files")
+	}
+
+	paths := newEntryPaths()
+	var entries []types.ArchiveEntry
+	for i := range files {
+		f := &files[i]
+		p := safeName(f.FileName, fmt.Sprintf("file-%d", f.ID))
+		// Keep the directory the file was uploaded with, if it is still sane
+		if dir, err := utils.CleanRelPath("rel_path", path.Dir(f.RelPath)); err == nil && dir != "" {
+			for d := dir; d != "."; d = path.Dir(d) {
+				paths.addDir(d)
+			}
+			p = dir + "/" + p
+		}
+		entries = append(entries, types.ArchiveEntry{Path: paths.addFile(p), File: f})
+	}
+	return entries, nil
+}
+
+func (s *ArchiveService) Write(ctx context.Context, w io.Writer, entries []types.ArchiveEntry, method uint16) error {
+	start := time.Now()
+	zw := zip.NewWriter(w)
+	var files, skipped int
+	var bytes int64
+	for _, e := range entries {
+		if e.File == nil {
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: e.Path + "/", Method: zip.Store, Modified: start}); err != nil {
+				return err
+			}
+			continue
+		}
+		n, err := s.add(ctx, zw, e, method)
+		if errSkipped(err) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		files++
+		bytes += n
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	slog.Info("📦 archive streamed",
+		"files",   files,
+		"skipped", skipped,
+		"bytes",   bytes,
+		"storage", s.store.Name(),
+		"took",    time.Since(start),
+	)
+	return nil
+}
+
+// skippedError marks an entry whose object could not be opened. Nothing has
+// been written for it yet, so the archive goes on without it.
+type skippedError struct{ error }
+
+func errSkipped(err error) bool {
+	_, ok := err.(skippedError)
+	return ok
+}
+
+func (s *ArchiveService) add(ctx context.Context, zw *zip.Writer, e types.ArchiveEntry, method uint16) (int64, error) {
+	r, err := s.store.Get(ctx, e.File.FilePath)
+	if err != nil {
+		slog.Warn("archive: object missing — skipped", "file_id", e.File.ID, "key", e.File.FilePath, "err", err)
+		return 0, skippedError{err}
+	}
+	defer r.Close()
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: e.Path, Method: method, Modified: e.File.UpdatedAt})
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(fw, r)
+	if err != nil {
+		return n, fmt.Errorf("archive %q: %w", e.Path, err)
+	}
+	return n, nil
+}
+
+// ─── Entry paths ──────────────────────────────────────────────────────────────
+
+// safeName returns name when it is a valid single path segment, else fallback.
+func safeName(name, fallback string) string {
+	if n, err := utils.CleanFileName("name", name); err == nil {
+		return n
+	}
+	return fallback
+}
+
+// entryPaths hands out unique paths inside one archive.
+type entryPaths map[string]bool
+
+func newEntryPaths() entryPaths { return entryPaths{} }
+
+// addDir records a directory and reports whether it is new. Folders of the
+// same name in one place share a directory.
+func (p entryPaths) addDir(dir string) bool {
+	if p[dir+"/"] {
+		return false
+	}
+	p[dir+"/"] = true
+	return true
+}
+
+// addFile records a file, numbering it when the path is taken.
+func (p entryPaths) addFile(name string) string {
+	if !p[name] && !p[name+"/"] {
+		p[name] = true
+		return name
+	}
+	dir, base := path.Split(name)
+	stem, ext := utils.SplitNumbered(base, true)
+	for n := 1; ; n++ {
+		c := dir + utils.NumberedName(stem, ext, n)
+		if !p[c] && !p[c+"/"] {
+			p[c] = true
+			return c
+		}
+	}
+}
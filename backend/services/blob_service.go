@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"fmt"
+	"log/slog"
+)
+
+// ── BlobService ───────────────────────────────────────────
+//
+// Content-addressed storage on top of IStorage. Every distinct (SHA-256,
+// size) is stored once, under
+//
+//	blobs/<sha[0:2]>/<sha>.<first upload id>
+//
+// and FileUpload rows point at it via BlobID. The upload-id suffix keeps a
+// blob that is being deleted from ever sharing a key with a fresh copy of the
+// same content. Files stored before dedup have no BlobID and own their
+// FilePath outright.
+//
+// A checksum declared at upload init proves nothing — anyone may know the
+// hash of someone else's file — so init only reuses content the user
+// already has (ReuseOwned). Across users, content is shared once the bytes
+// have arrived and their hash was computed here (Reuse, Commit).
+
+type BlobService struct {
+	repo  types.IBlobRepository
+	store types.IStorage
+	jobs  types.IJobQueue
+}
+
+func NewBlobService(repo types.IBlobRepository, store types.IStorage, jobs types.IJobQueue) types.IBlobService {
+	s := &BlobService{repo: repo, store: store, jobs: jobs}
+	jobs.Register("delete_objects", s.runPurge, nil)
+	return s
+}
+
+func (s *BlobService) Key(fu *models.FileUpload) string {
+	if len(fu.Checksum) < 2 {
+		return fmt.Sprintf("blobs/_/%d", fu.ID)
+	}
+	return fmt.Sprintf("blobs/%s/%s.%d", fu.Checksum[:2], fu.Checksum, fu.ID)
+}
+
+func (s *BlobService) Reuse(checksum string, size int64) *models.Blob {
+	if checksum == "" {
+		return nil
+	}
+	b, err := s.repo.Acquire(checksum, size)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (s *BlobService) ReuseOwned(userID uint, checksum string, size int64) *models.Blob {
+	if checksum == "" {
+		return nil
+	}
+	b, err := s.repo.AcquireOwned(userID, checksum, size)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (s *BlobService) Commit(ctx context.Context, checksum string, size int64, key string) (*models.Blob, error) {
+	b, created, err := s.repo.CreateOrAcquire(&models.Blob{Checksum: checksum, Size: size, Key: key})
+	if err != nil {
+		return nil, fmt.Errorf("commit blob: %w", err)
+	}
+	if !created && b.Key != key {
+		if err := s.store.Delete(ctx, key); err != nil {
+			slog.Warn("blob: duplicate delete failed", "key", key, "err", err)
+		}
+	}
+	return b, nil
+}
+
+func (s *BlobService) Release(ctx context.Context, fu *models.FileUpload) error {
+	if fu.BlobID == nil {
+		if fu.FilePath == "" {
+			return nil
+		}
+		return s.store.Delete(ctx, fu.FilePath)
+	}
+	b, gone, err := s.repo.Release(*fu.BlobID)
+	if err != nil {
+		return fmt.Errorf("release blob %d: %w", *fu.BlobID, err)
+	}
+	if !gone {
+		return nil
+	}
+	slog.Info("blob deleted — last reference gone", "blob_id", b.ID, "key", b.Key)
+	return s.store.Delete(ctx, b.Key)
+}
+
+// purgeJob is the payload of a "delete_objects" job.
+type purgeJob struct {
+	Objects []types.ObjectRef `json:"objects"`
+}
+
+func (s *BlobService) Purge(userID uint, objects []types.ObjectRef) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	payload, _ := json.Marshal(purgeJob{Objects: objects})
+	return s.jobs.Enqueue(&models.Job{UserID: userID, Kind: "delete_objects", Payload: string(payload)})
+}
+
+// runPurge deletes every object in the payload. Objects that could not be
+// deleted are written back into the payload, so a retry only goes over what
+// is left.
+func (s *BlobService) runPurge(ctx context.Context, job *models.Job) error {
+	var p purgeJob
+	if err := json.Unmarshal([]byte(job.Payload), &p); err != nil {
+		return fmt.Errorf("bad payload: %w", err)
+	}
+	mp, _ := s.store.(types.IMultipartStorage)
+
+	var left []types.ObjectRef
+	var last error
+	for _, o := range p.Objects {
+		var err error
+		switch {
+		case o.UploadID == "":
+			err = s.store.Delete(ctx, o.Key)
+		case mp != nil:
+			err = mp.AbortMultipart(ctx, o.Key, o.UploadID)
+		}
+		if err != nil {
+			left = append(left, o)
+			last = err
+		}
+	}
+	if len(left) > 0 {
+		payload, _ := json.Marshal(purgeJob{Objects: left})
+		job.Payload = string(payload)
+		return fmt.Errorf("%d of %d objects not deleted: %w", len(left), len(p.Objects), last)
+	}
+	slog.Info("🗑  objects deleted", "job_id", job.ID, "count", len(p.Objects), "storage", s.store.Name())
+	return nil
+}
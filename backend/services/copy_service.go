@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ── CopyService ───────────────────────────────────────────
+//
+// A copy is a new set of rows pointing at the same blobs: deduplicated
+// content is never copied, only referenced once more, so copying a tree of
+// any size is a single transaction.
+//
+// Files stored before dedup own their object and have no blob to share.
+// Their copies start out "processing" and a "copy_objects" job copies the
+// bytes into a blob of their own — in place where the backend can
+// (IObjectCopier), streamed through the server otherwise. The job reports
+// progress (files done of total) and retries only what is left.
+
+type CopyService struct {
+	files   types.IFileRepository
+	folders types.IFolderRepository
+	blobs   types.IBlobService
+	quota   types.IQuotaService
+	store   types.IStorage
+	queue   types.IJobQueue
+	jobs    types.IJobRepository
+}
+
+func NewCopyService(
+	files types.IFileRepository,
+	folders types.IFolderRepository,
+	blobs types.IBlobService,
+	quota types.IQuotaService,
+	store types.IStorage,
+	queue types.IJobQueue,
+	jobs types.IJobRepository,
+) types.ICopyService {
+	s := &CopyService{files: files, folders: folders, blobs: blobs, quota: quota, store: store, queue: queue, jobs: jobs}
+	queue.Register("copy_objects", s.runCopy, s.giveUpCopy)
+	return s
+}
+
+// destination checks a folder chosen to copy into; nil is the root.
+func (s *CopyService) destination(uid uint, field string, id *uint) error {
+	if id == nil {
+		return nil
+	}
+	f, err := s.folders.GetByID(*id, uid)
+	if err != nil {
+		return utils.NewFieldError(fiber.StatusNotFound, field, "folder not found")
+	}
+	if f.Trashed {
+		return utils.NewFieldError(fiber.StatusConflict, field, "folder is in the trash")
+	}
+	return nil
+}
+
+func (s *CopyService) CopyFile(uid, id uint, dest *uint, elsewhere bool, conflict types.NameConflict) (*types.Copy, error) {
+	f, err := s.files.GetByID(id)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "not found")
+	}
+	if f.UserID != uid {
+		return nil, utils.NewError(fiber.StatusForbidden, "forbidden")
+	}
+	if f.Trashed {
+		return nil, utils.NewError(fiber.StatusConflict, "file is in the trash")
+	}
+	if f.Status != "completed" {
+		return nil, utils.NewError(fiber.StatusConflict, "only completed files can be copied")
+	}
+	if !elsewhere {
+		dest = f.FolderID
+	} else if err := s.destination(uid, "folder_id", dest); err != nil {
+		return nil, err
+	}
+	// Fails early; Copy checks again under a lock on the user
+	if err := s.quota.Reserve(uid, f.FileSize); err != nil {
+		return nil, err
+	}
+
+	cp, err := s.files.Copy(id, uid, dest, conflict, s.quota.Limit)
+	if err != nil {
+		return nil, copyErr("copy file", id, s.quota.Exceeded(err, uid, f.FileSize), "a file with this name already exists there")
+	}
+	s.enqueue(uid, cp, &cp.File.ID)
+	slog.Info("file copied", "file_id", id, "copy_id", cp.File.ID, "user", uid, "job_id", cp.JobID)
+	return cp, nil
+}
+
+func (s *CopyService) CopyFolder(uid, id uint, dest *uint, elsewhere bool, conflict types.NameConflict) (*types.Copy, error) {
+	f, err := s.folders.GetByID(id, uid)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "folder not found")
+	}
+	if f.Trashed {
+		return nil, utils.NewError(fiber.StatusConflict, "folder is in the trash")
+	}
+	if !elsewhere {
+		dest = f.ParentID
+	} else if err := s.destination(uid, "parent_id", dest); err != nil {
+		return nil, err
+	}
+	size, err := s.folders.TreeSize(id, uid)
+	if err != nil {
+		slog.Error("copy folder: size failed", "id", id, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "copy failed")
+	}
+	// Fails early; CopyTree checks again under a lock on the user
+	if err := s.quota.Reserve(uid, size); err != nil {
+		return nil, err
+	}
+
+	cp, err := s.folders.CopyTree(id, uid, dest, conflict, s.quota.Limit)
+	if err != nil {
+		return nil, copyErr("copy folder", id, s.quota.Exceeded(err, uid, size), "a folder with this name already exists there")
+	}
+	s.enqueue(uid, cp, nil)
+	slog.Info("folder copied",
+		"id",      id,
+		"copy_id", cp.Folder.ID,
+		"user",    uid,
+		"folders", cp.Folders,
+		"files",   cp.Files,
+		"bytes",   cp.Bytes,
+		"job_id",  cp.JobID,
+	)
+	return cp, nil
+}
+
+// copyErr maps a repository error of a copy onto an AppError.
+func copyErr(op string, id uint, err error, taken string) error {
+	var ae *utils.AppError
+	if errors.As(err, &ae) {
+		return err
+	}
+	if errors.Is(err, types.ErrNameTaken) {
+		return utils.NewFieldError(fiber.StatusConflict, "name", taken)
+	}
+	slog.Error(op, "id", id, "err", err)
+	return utils.NewError(fiber.StatusInternalServerError, "copy failed")
+}
+
+// ─── copy_objects job ─────────────────────────────────────────────────────────
+
+// copyJob is the payload of a "copy_objects" job.
+type copyJob struct {
+	Objects []types.CopyObject `json:"objects"`
+}
+
+// enqueue queues the byte copies a copy left pending. If that fails the
+// copies stay "processing" and the error is logged; the rows themselves
+// are committed already.
+func (s *CopyService) enqueue(uid uint, cp *types.Copy, fileID *uint) {
+	if len(cp.Pending) == 0 {
+		return
+	}
+	payload, _ := json.Marshal(copyJob{Objects: cp.Pending})
+	job := &models.Job{UserID: uid, Kind: "copy_objects", FileUploadID: fileID, Payload: string(payload), Total: len(cp.Pending)}
+	if err := s.queue.Enqueue(job); err != nil {
+		slog.Error("copy: queueing byte copy failed", "user", uid, "objects", len(cp.Pending), "err", err)
+		return
+	}
+	cp.JobID = &job.ID
+}
+
+// runCopy copies every object in the payload. Objects that could not be
+// copied are written back into the payload, so a retry only goes over what
+// is left.
+func (s *CopyService) runCopy(ctx context.Context, job *models.Job) error {
+	var p copyJob
+	if err := json.Unmarshal([]byte(job.Payload), &p); err != nil {
+		return fmt.Errorf("bad payload: %w", err)
+	}
+
+	var left []types.CopyObject
+	var last error
+	for _, o := range p.Objects {
+		if err := s.copyObject(ctx, o); err != nil {
+			slog.Warn("copy: object failed", "job_id", job.ID, "file_id", o.FileID, "src", o.Src, "err", err)
+			left = append(left, o)
+			last = err
+			continue
+		}
+		job.Progress++
+		if err := s.jobs.Update(job); err != nil {
+			slog.Warn("copy: progress update failed", "job_id", job.ID, "err", err)
+		}
+	}
+	if len(left) > 0 {
+		payload, _ := json.Marshal(copyJob{Objects: left})
+		job.Payload = string(payload)
+		return fmt.Errorf("%d of %d objects not copied: %w", len(left), len(p.Objects), last)
+	}
+	slog.Info("📄 objects copied", "job_id", job.ID, "count", len(p.Objects), "storage", s.store.Name())
+	return nil
+}
+
+// copyObject gives one copy its own blob. A copy that was deleted or
+// finished meanwhile is skipped.
+func (s *CopyService) copyObject(ctx context.Context, o types.CopyObject) error {
+	fu, err := s.files.GetByID(o.FileID)
+	if err != nil || fu.BlobID != nil || (fu.Status != "processing" && fu.Status != "failed") {
+		return nil
+	}
+
+	// Same content stored meanwhile — share it instead
+	b := s.blobs.Reuse(fu.Checksum, fu.FileSize)
+	if b == nil {
+		key := s.blobs.Key(fu)
+		checksum, err := s.copyBytes(ctx, o.Src, key, fu)
+		if err != nil {
+			return err
+		}
+		if b, err = s.blobs.Commit(ctx, checksum, fu.FileSize, key); err != nil {
+			return err
+		}
+	}
+
+	done, err := s.files.CompleteCopy(fu.ID, b)
+	if err == nil && done {
+		return nil
+	}
+	if rerr := s.blobs.Release(ctx, &models.FileUpload{BlobID: &b.ID}); rerr != nil {
+		slog.Warn("copy: releasing unused blob failed", "blob_id", b.ID, "err", rerr)
+	}
+	return err
+}
+
+// copyBytes writes the object at src to dst and returns the content's
+// checksum. Content without a recorded checksum is streamed and hashed.
+func (s *CopyService) copyBytes(ctx context.Context, src, dst string, fu *models.FileUpload) (string, error) {
+	if c, ok := s.store.(types.IObjectCopier); ok && fu.Checksum != "" {
+		return fu.Checksum, c.Copy(ctx, src, dst)
+	}
+	r, err := s.store.Get(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if err := s.store.Put(ctx, dst, io.TeeReader(r, h), fu.FileSize, fu.FileType); err != nil {
+		return "", err
+	}
+	if fu.Checksum != "" {
+		return fu.Checksum, nil
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// giveUpCopy marks the copies the job could not finish as failed; a retry
+// of the job picks them up again.
+func (s *CopyService) giveUpCopy(_ context.Context, job *models.Job) error {
+	var p copyJob
+	if err := json.Unmarshal([]byte(job.Payload), &p); err != nil {
+		return err
+	}
+	for _, o := range p.Objects {
+		fu, err := s.files.GetByID(o.FileID)
+		if err != nil || fu.Status != "processing" {
+			continue
+		}
+		fu.Status = "failed"
+		if err := s.files.Update(fu); err != nil {
+			slog.Error("copy: marking copy failed", "file_id", fu.ID, "err", err)
+		}
+	}
+	return nil
+}
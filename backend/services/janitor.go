@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"file-transfer-backend/config"
+	"file-transfer-backend/types"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ── Janitor ───────────────────────────────────────────────
+//
+// Janitor periodically cleans up after uploads that were never finished:
+//
+//  1. pending/uploading uploads idle for UPLOAD_EXPIRY_HOURS become "expired";
+//     their staged bytes and unfinished multipart upload are dropped
+//  2. failed and expired rows older than JANITOR_RETENTION_HOURS are deleted
+//     with their share links, grants and jobs; multipart uploads they left
+//     are aborted
+//  3. file_chunks rows of uploads that no longer take chunks are deleted
+//  4. staging entries whose upload is gone or done are removed
+//  5. files and folders trashed more than TRASH_RETENTION_DAYS ago are
+//     deleted for good, bytes included
+//
+// Every step is idempotent and safe to run on several instances at once.
+
+type Janitor struct {
+	files   types.IFileRepository
+	staging types.IStagingService
+	mp      types.IMultipartUploader // nil = storage has no multipart support
+	trash   types.ITrashService
+	blobs   types.IBlobService
+	upload  *config.UploadConfig
+	cfg     *config.JanitorConfig
+
+	mu   sync.Mutex
+	last *types.JanitorReport
+}
+
+func NewJanitor(
+	files types.IFileRepository,
+	staging types.IStagingService,
+	mp types.IMultipartUploader,
+	trash types.ITrashService,
+	blobs types.IBlobService,
+	upload *config.UploadConfig,
+	cfg *config.JanitorConfig,
+) types.IJanitor {
+	return &Janitor{files: files, staging: staging, mp: mp, trash: trash, blobs: blobs, upload: upload, cfg: cfg}
+}
+
+// Start runs the janitor now and then every IntervalMinutes until ctx is
+// cancelled.
+func (j *Janitor) Start(ctx context.Context) {
+	if j.cfg.IntervalMinutes <= 0 {
+		slog.Info("janitor disabled")
+		return
+	}
+	interval := time.Duration(j.cfg.IntervalMinutes) * time.Minute
+	go func() {
+		for {
+			j.Run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+	slog.Info("janitor started", "interval", interval)
+}
+
+func (j *Janitor) Run(ctx context.Context) *types.JanitorReport {
+	start := time.Now()
+	r := &types.JanitorReport{StartedAt: start}
+	fail := func(step string, err error) {
+		slog.Error("janitor: "+step+" failed", "err", err)
+		r.Errors = append(r.Errors, step+": "+err.Error())
+	}
+
+	// 1. Expire stale uploads and free what they staged
+	stale, err := j.files.ExpireStale(start.Add(-time.Duration(j.upload.ExpiryHours) * time.Hour))
+	if err != nil {
+		fail("expire", err)
+	}
+	for _, fu := range stale {
+		if err := j.staging.Discard(fu.ID); err != nil {
+			slog.Warn("janitor: discard staging failed", "file_id", fu.ID, "err", err)
+		}
+		if j.mp != nil && fu.MultipartID != "" {
+			j.mp.Abort(ctx, fu.ID, fu.MultipartKey, fu.MultipartID)
+		}
+	}
+	r.Expired = len(stale)
+
+	// 2. Forget failed and expired uploads after the retention period
+	dead, err := j.files.PurgeDead(start.Add(-time.Duration(j.cfg.RetentionHours) * time.Hour))
+	if err != nil {
+		fail("purge", err)
+	}
+	for uid, del := range dead {
+		r.Purged += int64(del.Files)
+		j.release(ctx, uid, del.Objects)
+	}
+
+	// 3. Chunk rows are only needed while an upload can still be resumed
+	if r.ChunkRows, err = j.files.DeleteOrphanChunks(); err != nil {
+		fail("chunks", err)
+	}
+
+	// 4. Staging entries nobody will come back for
+	if err := j.sweepStaging(r); err != nil {
+		fail("staging", err)
+	}
+
+	// 5. Trash retention
+	if j.cfg.TrashRetentionDays > 0 {
+		del, err := j.trash.PurgeExpired(start.AddDate(0, 0, -j.cfg.TrashRetentionDays))
+		if err != nil {
+			fail("trash", err)
+		}
+		if del != nil {
+			r.Trash = *del
+		}
+	}
+
+	r.DurationMs = time.Since(start).Milliseconds()
+	j.mu.Lock()
+	j.last = r
+	j.mu.Unlock()
+
+	slog.Info("🧹 janitor run",
+		"expired",       r.Expired,
+		"purged",        r.Purged,
+		"chunk_rows",    r.ChunkRows,
+		"staging",       r.Staging,
+		"trash_files",   r.Trash.Files,
+		"trash_folders", r.Trash.Folders,
+		"errors",        len(r.Errors),
+		"took",          time.Since(start),
+	)
+	return r
+}
+
+// release aborts the multipart uploads of purged rows, as expiring does, and
+// hands content that lost its last reference to a delete_objects job.
+func (j *Janitor) release(ctx context.Context, uid uint, objects []types.ObjectRef) {
+	var rest []types.ObjectRef
+	for _, o := range objects {
+		if o.UploadID == "" {
+			rest = append(rest, o)
+			continue
+		}
+		if j.mp != nil {
+			j.mp.Abort(ctx, o.FileID, o.Key, o.UploadID)
+		}
+	}
+	if err := j.blobs.Purge(uid, rest); err != nil {
+		slog.Error("janitor: purge objects failed", "user", uid, "objects", len(rest), "err", err)
+	}
+}
+
+// sweepStaging discards staged data of uploads that are finished, expired or
+// deleted. Bytes of failed uploads stay until the row itself is purged.
+func (j *Janitor) sweepStaging(r *types.JanitorReport) error {
+	ids, err := j.staging.List()
+	if err != nil {
+		return err
+	}
+	keep, err := j.files.Unfinished(ids)
+	if err != nil {
+		return err
+	}
+	kept := make(map[uint]bool, len(keep))
+	for _, id := range keep {
+		kept[id] = true
+	}
+	for _, id := range ids {
+		if kept[id] {
+			continue
+		}
+		if err := j.staging.Discard(id); err != nil {
+			slog.Warn("janitor: discard staging failed", "file_id", id, "err", err)
+			continue
+		}
+		r.Staging++
+	}
+	return nil
+}
+
+func (j *Janitor) LastRun() *types.JanitorReport {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
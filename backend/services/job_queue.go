@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"file-transfer-backend/config"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ── JobQueue ──────────────────────────────────────────────
+//
+// JobQueue is a small durable worker pool backed by the jobs table. Work is
+// claimed with SELECT … FOR UPDATE SKIP LOCKED, so it is safe to run several
+// workers and several server instances against one database. A failed run is
+// retried with exponential backoff (base, 2·base, 4·base, … capped at
+// maxBackoff) until the job's MaxAttempts is used up.
+//
+// A claimed job is leased: its worker bumps updated_at every third of
+// LeaseSeconds while it runs. Every instance periodically re-queues running
+// jobs whose lease ran out, so work of a crashed instance is picked up by
+// the others, and a job a live peer is running is never started twice. Each
+// claim carries a fresh lease token; a run that lost its lease is cancelled
+// and cannot write its outcome over the run that took the job over. A run
+// is also cancelled after TimeoutSeconds.
+
+const maxBackoff = 30 * time.Minute
+
+type jobKind struct {
+	run      types.JobFunc
+	onGiveUp types.JobFunc
+}
+
+type JobQueue struct {
+	repo    types.IJobRepository
+	cfg     *config.JobsConfig
+	retries int
+
+	mu    sync.RWMutex
+	kinds map[string]jobKind
+	wake  chan struct{}
+}
+
+func NewJobQueue(repo types.IJobRepository, cfg *config.JobsConfig, maxRetries int) types.IJobQueue {
+	return &JobQueue{
+		repo:    repo,
+		cfg:     cfg,
+		retries: maxRetries,
+		kinds:   map[string]jobKind{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+func (q *JobQueue) Register(kind string, run types.JobFunc, onGiveUp types.JobFunc) {
+	q.mu.Lock()
+	q.kinds[kind] = jobKind{run: run, onGiveUp: onGiveUp}
+	q.mu.Unlock()
+}
+
+// Enqueue persists a job and nudges an idle worker. MaxAttempts defaults to
+// one try plus UploadConfig.MaxRetries retries.
+func (q *JobQueue) Enqueue(job *models.Job) error {
+	job.Status = "queued"
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = q.retries + 1
+	}
+	if job.NextRunAt.IsZero() {
+		job.NextRunAt = time.Now()
+	}
+	if err := q.repo.Create(job); err != nil {
+		return fmt.Errorf("enqueue %s: %w", job.Kind, err)
+	}
+	q.notify()
+	return nil
+}
+
+// Retry gives a failed job a fresh set of attempts.
+func (q *JobQueue) Retry(job *models.Job) error {
+	job.Status    = "queued"
+	job.Attempts  = 0
+	job.NextRunAt = time.Now()
+	if err := q.repo.Update(job); err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start launches the workers and the lease reaper, which also re-queues
+// jobs orphaned by a previous process right away. Both stop when ctx is
+// cancelled.
+func (q *JobQueue) Start(ctx context.Context) {
+	for i := 0; i < q.cfg.Workers; i++ {
+		go q.worker(ctx)
+	}
+	go q.reaper(ctx)
+	slog.Info("job queue started", "workers", q.cfg.Workers, "lease", q.lease())
+}
+
+func (q *JobQueue) lease() time.Duration {
+	if q.cfg.LeaseSeconds <= 0 {
+		return 2 * time.Minute
+	}
+	return time.Duration(q.cfg.LeaseSeconds) * time.Second
+}
+
+// reaper re-queues running jobs whose lease expired, once per lease.
+func (q *JobQueue) reaper(ctx context.Context) {
+	for {
+		if n, err := q.repo.RequeueExpired(time.Now().Add(-q.lease())); err != nil {
+			slog.Error("job queue: requeue failed", "err", err)
+		} else if n > 0 {
+			slog.Info("↻  job queue: resumed abandoned jobs", "count", n)
+			q.notify()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.lease()):
+		}
+	}
+}
+
+// heartbeat renews job's lease until stop is closed. When the lease is lost
+// the run is cancelled: the job is queued again and no longer this run's.
+func (q *JobQueue) heartbeat(job *models.Job, stop <-chan struct{}, cancel context.CancelFunc) {
+	tick := time.NewTicker(q.lease() / 3)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			held, err := q.repo.Heartbeat(job.ID, job.Lease, time.Now())
+			if err != nil {
+				slog.Warn("job queue: heartbeat failed", "job_id", job.ID, "err", err)
+				continue
+			}
+			if !held {
+				slog.Warn("job queue: lease lost — cancelling run", "job_id", job.ID, "kind", job.Kind)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// newLease returns a token identifying one run of a job.
+func newLease() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (q *JobQueue) worker(ctx context.Context) {
+	poll := time.Duration(q.cfg.PollSeconds) * time.Second
+	for {
+		var job *models.Job
+		lease, err := newLease()
+		if err == nil {
+			job, err = q.repo.ClaimNext(time.Now(), lease)
+		}
+		if err != nil {
+			slog.Error("job queue: claim failed", "err", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(poll):
+		}
+	}
+}
+
+func (q *JobQueue) run(ctx context.Context, job *models.Job) {
+	q.mu.RLock()
+	kind, ok := q.kinds[job.Kind]
+	q.mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler for job kind %q", job.Kind)
+	} else {
+		runCtx, cancel := q.runContext(ctx)
+		stop := make(chan struct{})
+		go q.heartbeat(job, stop, cancel)
+		err = kind.run(runCtx, job)
+		close(stop)
+		cancel()
+	}
+
+	if err == nil {
+		job.Status    = "done"
+		job.LastError = ""
+		q.finish(job)
+		return
+	}
+
+	job.LastError = err.Error()
+	if job.Attempts >= job.MaxAttempts {
+		job.Status = "failed"
+		if !q.finish(job) {
+			return
+		}
+		slog.Error("✗  job failed permanently",
+			"job_id",   job.ID,
+			"kind",     job.Kind,
+			"attempts", job.Attempts,
+			"err",      err,
+		)
+		if ok && kind.onGiveUp != nil {
+			kind.onGiveUp(ctx, job)
+		}
+		return
+	}
+
+	delay := time.Duration(q.cfg.RetryBaseSeconds) * time.Second << (job.Attempts - 1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	job.Status    = "queued"
+	job.NextRunAt = time.Now().Add(delay)
+	if !q.finish(job) {
+		return
+	}
+	slog.Warn("job failed — will retry",
+		"job_id",   job.ID,
+		"kind",     job.Kind,
+		"attempt",  job.Attempts,
+		"retry_in", delay,
+		"err",      err,
+	)
+}
+
+// runContext bounds one run by TimeoutSeconds, when set.
+func (q *JobQueue) runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if q.cfg.TimeoutSeconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(q.cfg.TimeoutSeconds)*time.Second)
+}
+
+// finish writes the outcome of job's run. It reports false when the run
+// lost its lease, or the write failed; the job then belongs to whoever holds
+// it now, or is re-queued once the lease runs out.
+func (q *JobQueue) finish(job *models.Job) bool {
+	held, err := q.repo.Finish(job)
+	if err != nil {
+		slog.Error("job queue: saving outcome failed", "job_id", job.ID, "status", job.Status, "err", err)
+		return false
+	}
+	if !held {
+		slog.Warn("job queue: lease lost — outcome dropped", "job_id", job.ID, "kind", job.Kind, "status", job.Status)
+	}
+	return held
+}
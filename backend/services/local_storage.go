@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"file-transfer-backend/types"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStorage keeps files under a directory on the server's disk
+// (UPLOAD_DIR). Keys map to relative paths below that root.
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) (types.IStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("storage dir %q: %w", root, err)
+	}
+	return &LocalStorage{root: filepath.Clean(root)}, nil
+}
+
+func (s *LocalStorage) Name() string { return "local" }
+
+// path resolves a key to a file below root, refusing keys that would escape
+// it. Rows written before storage keys existed hold the full on-disk path
+// (e.g. "uploads/42/report.pdf"); those are used as-is.
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if strings.HasPrefix(clean, s.root+string(filepath.Separator)) {
+		return clean, nil
+	}
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, clean), nil
+}
+
+// Put writes r to a temp file next to the target and renames it into place,
+// so readers never see a half-written object.
+func (s *LocalStorage) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write %q: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// PutFile moves a file that is already on disk (a finished staging file) into
+// place — a rename when both live on the same filesystem.
+func (s *LocalStorage) PutFile(_ context.Context, key, src string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	return moveFile(src, p)
+}
+
+// Copy duplicates an object on disk; like Put, the copy appears atomically.
+func (s *LocalStorage) Copy(ctx context.Context, src, dst string) error {
+	r, err := s.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return s.Put(ctx, dst, r, 0, "")
+}
+
+func (s *LocalStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%q: %w", key, ErrObjectNotFound)
+	}
+	return f, err
+}
+
+// GetRange opens key and seeks to offset; the reader stops after length bytes.
+func (s *LocalStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	f := r.(*os.File)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *LocalStorage) Stat(_ context.Context, key string) (*types.ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%q: %w", key, ErrObjectNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &types.ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file; deleting a missing key is not an error.
+func (s *LocalStorage) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Presign is not available on local disk — the server streams the file.
+func (s *LocalStorage) Presign(context.Context, string, string, time.Duration) (string, error) {
+	return "", nil
+}
+
+// List returns every object whose key starts with prefix. Dot-directories
+// (the default staging dir lives in UPLOAD_DIR/.staging) are skipped.
+func (s *LocalStorage) List(_ context.Context, prefix string) ([]types.ObjectInfo, error) {
+	dir := path.Dir(prefix)
+	if strings.HasSuffix(prefix, "/") {
+		dir = strings.TrimSuffix(prefix, "/")
+	}
+	start, err := s.path(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []types.ObjectInfo
+	err = filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != start {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		out = append(out, types.ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return out, err
+}
+
+// moveFile renames src to dst, falling back to a streamed copy when the
+// staging dir lives on a different filesystem than the upload dir.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil { return err }
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil { return err }
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil { return err }
+	return os.Remove(src)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"file-transfer-backend/types"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps objects in a map. Everything is lost on restart — it is
+// meant for tests and throwaway dev instances (STORAGE_BACKEND=memory).
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memObject
+}
+
+type memObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemoryStorage() types.IStorage {
+	return &MemoryStorage{objects: map[string]memObject{}}
+}
+
+func (s *MemoryStorage) Name() string { return "memory" }
+
+func (s *MemoryStorage) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read %q: %w", key, err)
+	}
+	s.mu.Lock()
+	s.objects[key] = memObject{data: data, modTime: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+// PutFile loads a staged file and removes it from disk.
+func (s *MemoryStorage) PutFile(ctx context.Context, key, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	err = s.Put(ctx, key, f, 0, "")
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (s *MemoryStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", key, ErrObjectNotFound)
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (s *MemoryStorage) GetRange(_ context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", key, ErrObjectNotFound)
+	}
+	if offset > int64(len(obj.data)) {
+		offset = int64(len(obj.data))
+	}
+	end := min(offset+length, int64(len(obj.data)))
+	return io.NopCloser(bytes.NewReader(obj.data[offset:end])), nil
+}
+
+// Copy shares the stored bytes; objects are never modified in place.
+func (s *MemoryStorage) Copy(_ context.Context, src, dst string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[src]
+	if !ok {
+		return fmt.Errorf("%q: %w", src, ErrObjectNotFound)
+	}
+	s.objects[dst] = memObject{data: obj.data, modTime: time.Now()}
+	return nil
+}
+
+func (s *MemoryStorage) Stat(_ context.Context, key string) (*types.ObjectInfo, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", key, ErrObjectNotFound)
+	}
+	return &types.ObjectInfo{Key: key, Size: int64(len(obj.data)), ModTime: obj.modTime}, nil
+}
+
+func (s *MemoryStorage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.objects, key)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) Presign(context.Context, string, string, time.Duration) (string, error) {
+	return "", nil
+}
+
+func (s *MemoryStorage) List(_ context.Context, prefix string) ([]types.ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []types.ObjectInfo
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, types.ObjectInfo{Key: key, Size: int64(len(obj.data)), ModTime: obj.modTime})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"file-transfer-backend/config"
+	"file-transfer-backend/types"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// ── MultipartUploader ─────────────────────────────────────
+//
+// MultipartUploader pushes large uploads to multipart storage while they are
+// still arriving. The staging file is cut into fixed-size parts:
+//
+//	part n  =  staged bytes [(n-1)·partSize, n·partSize)
+//
+// As soon as a whole part is staged it is sent in the background, with at
+// most `concurrency` part uploads in flight per process. On complete only the
+// tail (and anything that failed or was never sent, e.g. after a restart) is
+// left to upload before the object is assembled. The storage backend is the
+// source of truth for which parts it holds, so no per-part state is persisted.
+
+// minPartSize is the S3 minimum for every part but the last.
+const minPartSize = 5 << 20
+
+type MultipartUploader struct {
+	store    types.IMultipartStorage
+	partSize int64
+	sem      chan struct{}
+
+	mu      sync.Mutex
+	uploads map[uint]*multipartUpload
+}
+
+type multipartUpload struct {
+	mu       sync.Mutex
+	next     int // next part number to schedule
+	inflight sync.WaitGroup
+}
+
+// NewMultipartUploader returns nil when the storage backend has no multipart
+// support — callers then fall back to a single Put on complete.
+func NewMultipartUploader(store types.IStorage, cfg *config.S3Config) types.IMultipartUploader {
+	mp, ok := store.(types.IMultipartStorage)
+	if !ok {
+		return nil
+	}
+	partSize := int64(cfg.PartSizeMB) << 20
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	concurrency := cfg.PartConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &MultipartUploader{
+		store:    mp,
+		partSize: partSize,
+		sem:      make(chan struct{}, concurrency),
+		uploads:  map[uint]*multipartUpload{},
+	}
+}
+
+func (m *MultipartUploader) PartSize() int64 { return m.partSize }
+
+func (m *MultipartUploader) Begin(ctx context.Context, key, contentType string) (string, error) {
+	return m.store.CreateMultipart(ctx, key, contentType)
+}
+
+// state returns the in-process state of an upload, attaching it on first
+// use. After a restart the parts storage already holds are not re-sent.
+func (m *MultipartUploader) state(fileID uint, key, uploadID string) *multipartUpload {
+	m.mu.Lock()
+	u, ok := m.uploads[fileID]
+	m.mu.Unlock()
+	if ok {
+		return u
+	}
+
+	u = &multipartUpload{next: 1}
+	if parts, err := m.store.ListParts(context.Background(), key, uploadID); err == nil {
+		have := map[int]bool{}
+		for _, p := range parts {
+			have[p.Number] = p.Size == m.partSize
+		}
+		for have[u.next] {
+			u.next++
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.uploads[fileID]; ok {
+		return existing
+	}
+	m.uploads[fileID] = u
+	return u
+}
+
+func (m *MultipartUploader) Progress(fileID uint, key, uploadID, path string, size int64) {
+	u := m.state(fileID, key, uploadID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for int64(u.next)*m.partSize <= size {
+		n := u.next
+		u.next++
+		u.inflight.Add(1)
+		go func() {
+			defer u.inflight.Done()
+			if _, err := m.sendPart(context.Background(), key, uploadID, path, n, m.partSize); err != nil {
+				// Not fatal — Complete re-sends whatever storage does not have
+				slog.Warn("multipart: part upload failed", "file_id", fileID, "part", n, "err", err)
+			}
+		}()
+	}
+}
+
+// sendPart uploads part n from the staged file, holding a concurrency slot.
+func (m *MultipartUploader) sendPart(ctx context.Context, key, uploadID, path string, n int, size int64) (string, error) {
+	m.sem <- struct{}{}
+	defer func() { <-m.sem }()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open staged file: %w", err)
+	}
+	defer f.Close()
+	r := io.NewSectionReader(f, int64(n-1)*m.partSize, size)
+	return m.store.UploadPart(ctx, key, uploadID, n, r, size)
+}
+
+// forget waits for background parts of an upload and drops its state.
+func (m *MultipartUploader) forget(fileID uint) {
+	m.mu.Lock()
+	u, ok := m.uploads[fileID]
+	delete(m.uploads, fileID)
+	m.mu.Unlock()
+	if ok {
+		u.inflight.Wait()
+	}
+}
+
+func (m *MultipartUploader) Complete(ctx context.Context, fileID uint, key, uploadID, path string, size int64) error {
+	m.forget(fileID)
+
+	stored, err := m.store.ListParts(ctx, key, uploadID)
+	if err != nil {
+		return err
+	}
+	have := map[int]types.StoredPart{}
+	for _, p := range stored {
+		have[p.Number] = p
+	}
+
+	count := int((size + m.partSize - 1) / m.partSize)
+	if count == 0 {
+		count = 1
+	}
+	parts := make([]types.StoredPart, count)
+	errs := make(chan error, count)
+	var wg sync.WaitGroup
+	for n := 1; n <= count; n++ {
+		want := m.partSize
+		if n == count {
+			want = size - int64(n-1)*m.partSize
+		}
+		if p, ok := have[n]; ok && p.Size == want {
+			parts[n-1] = p
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			etag, err := m.sendPart(ctx, key, uploadID, path, n, want)
+			if err != nil {
+				errs <- err
+				return
+			}
+			parts[n-1] = types.StoredPart{Number: n, ETag: etag, Size: want}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return m.store.CompleteMultipart(ctx, key, uploadID, parts)
+}
+
+func (m *MultipartUploader) Abort(ctx context.Context, fileID uint, key, uploadID string) {
+	m.forget(fileID)
+	if err := m.store.AbortMultipart(ctx, key, uploadID); err != nil {
+		slog.Warn("multipart: abort failed", "file_id", fileID, "key", key, "err", err)
+	}
+}
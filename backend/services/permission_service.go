@@ -0,0 +1,204 @@
+package services
+
+import (
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ── PermissionService ─────────────────────────────────────
+//
+// Owners can do anything with their own files and folders. Anyone else
+// needs a grant — viewer, commenter or editor — on the item or on a folder
+// above it; the highest such role applies. Grants are made by the owner,
+// by email, and only to registered users.
+//
+// Access is checked once, when a handler loads the item. What follows runs
+// as the owner: an editor's rename goes through the owner's name lock, a
+// copy is charged to the owner's quota and lands in the owner's drive.
+// Items in the trash are seen by their owner only, so restoring and
+// deleting for good stay with the owner.
+
+type PermissionService struct {
+	grants  types.IGrantRepository
+	files   types.IFileRepository
+	folders types.IFolderRepository
+	users   types.IUserRepository
+}
+
+func NewPermissionService(grants types.IGrantRepository, files types.IFileRepository, folders types.IFolderRepository, users types.IUserRepository) types.IPermissionService {
+	return &PermissionService{grants: grants, files: files, folders: folders, users: users}
+}
+
+func (s *PermissionService) File(uid, id uint, need types.Role) (*models.FileUpload, error) {
+	f, err := s.files.GetByID(id)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "not found")
+	}
+	if f.UserID == uid {
+		return f, nil
+	}
+	var folderID uint
+	if f.FolderID != nil {
+		folderID = *f.FolderID
+	}
+	if err := s.check(uid, f.Trashed, f.ID, folderID, need); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *PermissionService) Folder(uid, id uint, need types.Role) (*models.Folder, error) {
+	f, err := s.folders.Find(id)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "folder not found")
+	}
+	if f.UserID == uid {
+		return f, nil
+	}
+	if err := s.check(uid, f.Trashed, 0, f.ID, need); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// check decides for a user who doesn't own the item.
+func (s *PermissionService) check(uid uint, trashed bool, fileID, folderID uint, need types.Role) error {
+	if trashed {
+		return utils.NewError(fiber.StatusForbidden, "forbidden")
+	}
+	roles, err := s.grants.RolesOn(uid, fileID, folderID)
+	if err != nil {
+		slog.Error("permissions: role lookup failed", "user", uid, "file_id", fileID, "folder_id", folderID, "err", err)
+		return utils.NewError(fiber.StatusInternalServerError, "permission check failed")
+	}
+	var role types.Role
+	for _, r := range roles {
+		if r.Includes(role) {
+			role = r
+		}
+	}
+	switch {
+	case role == "":
+		return utils.NewError(fiber.StatusForbidden, "forbidden")
+	case need == types.RoleOwner:
+		return utils.NewError(fiber.StatusForbidden, "only the owner can do this")
+	case !role.Includes(need):
+		return utils.NewError(fiber.StatusForbidden, "this needs "+string(need)+" access")
+	}
+	return nil
+}
+
+func (s *PermissionService) Destination(uid, owner uint, field string, folderID *uint) error {
+	if folderID == nil {
+		if uid != owner {
+			return utils.NewFieldError(fiber.StatusForbidden, field, "only the owner can put items at the top level of their drive")
+		}
+		return nil
+	}
+	f, err := s.Folder(uid, *folderID, types.RoleEditor)
+	if err != nil {
+		if ae, ok := err.(*utils.AppError); ok {
+			ae.Field = field
+		}
+		return err
+	}
+	if f.UserID != owner {
+		return utils.NewFieldError(fiber.StatusConflict, field, "folder is in another user's drive")
+	}
+	if f.Trashed {
+		return utils.NewFieldError(fiber.StatusConflict, field, "folder is in the trash")
+	}
+	return nil
+}
+
+// ─── Grants ───────────────────────────────────────────────────────────────────
+
+// owned checks that uid owns the item a grant request names.
+func (s *PermissionService) owned(uid uint, fileID, folderID *uint) error {
+	if (fileID == nil) == (folderID == nil) {
+		return utils.NewError(fiber.StatusBadRequest, "exactly one of file and folder is required")
+	}
+	var trashed bool
+	if fileID != nil {
+		f, err := s.File(uid, *fileID, types.RoleOwner)
+		if err != nil {
+			return err
+		}
+		trashed = f.Trashed
+	} else {
+		f, err := s.Folder(uid, *folderID, types.RoleOwner)
+		if err != nil {
+			return err
+		}
+		trashed = f.Trashed
+	}
+	if trashed {
+		return utils.NewError(fiber.StatusConflict, "item is in the trash")
+	}
+	return nil
+}
+
+func (s *PermissionService) Grants(uid uint, fileID, folderID *uint) ([]types.GrantEntry, error) {
+	if err := s.owned(uid, fileID, folderID); err != nil {
+		return nil, err
+	}
+	grants, err := s.grants.ListForItem(fileID, folderID)
+	if err != nil {
+		slog.Error("permissions: grant list failed", "user", uid, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "list failed")
+	}
+	return grants, nil
+}
+
+func (s *PermissionService) Grant(uid uint, fileID, folderID *uint, email string, role types.Role) (*types.GrantEntry, error) {
+	switch role {
+	case types.RoleViewer, types.RoleCommenter, types.RoleEditor:
+	default:
+		return nil, utils.NewFieldError(fiber.StatusBadRequest, "role", `role must be "viewer", "commenter" or "editor"`)
+	}
+	if err := s.owned(uid, fileID, folderID); err != nil {
+		return nil, err
+	}
+	user, err := s.users.FindByEmail(strings.TrimSpace(email))
+	if err != nil {
+		return nil, utils.NewFieldError(fiber.StatusNotFound, "email", "no user with this email")
+	}
+	if user.ID == uid {
+		return nil, utils.NewFieldError(fiber.StatusBadRequest, "email", "you already own this item")
+	}
+
+	g := &models.Grant{OwnerID: uid, UserID: user.ID, FileUploadID: fileID, FolderID: folderID, Role: string(role)}
+	if err := s.grants.Upsert(g); err != nil {
+		slog.Error("permissions: grant failed", "user", uid, "grantee", user.ID, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "grant failed")
+	}
+	slog.Info("🤝 access granted", "grant_id", g.ID, "owner", uid, "grantee", user.ID, "file_id", fileID, "folder_id", folderID, "role", role)
+	return &types.GrantEntry{Grant: *g, Email: user.Email, Name: user.Name}, nil
+}
+
+func (s *PermissionService) Revoke(uid, id uint) error {
+	g, err := s.grants.GetByID(id)
+	if err != nil || (g.OwnerID != uid && g.UserID != uid) {
+		return utils.NewError(fiber.StatusNotFound, "grant not found")
+	}
+	if err := s.grants.Delete(id); err != nil {
+		slog.Error("permissions: revoke failed", "grant_id", id, "err", err)
+		return utils.NewError(fiber.StatusInternalServerError, "revoke failed")
+	}
+	slog.Info("access revoked", "grant_id", id, "by", uid, "owner", g.OwnerID, "grantee", g.UserID)
+	return nil
+}
+
+func (s *PermissionService) SharedWithMe(uid uint) (*types.SharedWithMe, error) {
+	shared, err := s.grants.SharedWith(uid)
+	if err != nil {
+		slog.Error("permissions: shared list failed", "user", uid, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "list failed")
+	}
+	return shared, nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"testing"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	order := []types.Role{types.RoleViewer, types.RoleCommenter, types.RoleEditor, types.RoleOwner}
+	for i, r := range order {
+		for j, need := range order {
+			if got := r.Includes(need); got != (i >= j) {
+				t.Fatalf("%s.Includes(%s) = %v", r, need, got)
+			}
+		}
+	}
+	if types.Role("admin").Includes(types.RoleViewer) || types.Role("").Includes(types.RoleViewer) {
+		t.Fatal("unknown role includes viewer")
+	}
+}
+
+func TestPermissionFolder(t *testing.T) {
+	const owner, other = 1, 2
+	lookupErr := errors.New("db down")
+
+	tests := []struct {
+		name    string
+		uid     uint
+		trashed bool
+		roles   []types.Role
+		err     error
+		need    types.Role
+		code    int // 0 = allowed
+		message string
+	}{
+		{"owner needs no grant", owner, false, nil, nil, types.RoleOwner, 0, ""},
+		{"owner sees own trash", owner, true, nil, nil, types.RoleOwner, 0, ""},
+		{"no grant", other, false, nil, nil, types.RoleViewer, 403, "forbidden"},
+		{"viewer reads", other, false, []types.Role{types.RoleViewer}, nil, types.RoleViewer, 0, ""},
+		{"viewer can't edit", other, false, []types.Role{types.RoleViewer}, nil, types.RoleEditor, 403, "this needs editor access"},
+		{"commenter can't edit", other, false, []types.Role{types.RoleCommenter}, nil, types.RoleEditor, 403, "this needs editor access"},
+		{"editor edits", other, false, []types.Role{types.RoleEditor}, nil, types.RoleEditor, 0, ""},
+		{"highest role wins", other, false, []types.Role{types.RoleViewer, types.RoleEditor, types.RoleCommenter}, nil, types.RoleEditor, 0, ""},
+		{"highest role wins in any order", other, false, []types.Role{types.RoleEditor, types.RoleViewer}, nil, types.RoleEditor, 0, ""},
+		{"unknown role ignored", other, false, []types.Role{"admin"}, nil, types.RoleViewer, 403, "forbidden"},
+		{"unknown role next to a real one", other, false, []types.Role{types.RoleViewer, "admin"}, nil, types.RoleViewer, 0, ""},
+		{"editor isn't owner", other, false, []types.Role{types.RoleEditor}, nil, types.RoleOwner, 403, "only the owner can do this"},
+		{"trash is owner only", other, true, []types.Role{types.RoleEditor}, nil, types.RoleViewer, 403, "forbidden"},
+		{"lookup failure", other, false, nil, lookupErr, types.RoleViewer, 500, "permission check failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &PermissionService{
+				grants:  &fakeGrants{roles: tt.roles, err: tt.err},
+				folders: &fakeFolders{folder: &models.Folder{ID: 7, UserID: owner, Trashed: tt.trashed}},
+			}
+			_, err := s.Folder(tt.uid, 7, tt.need)
+			checkAppError(t, err, tt.code, tt.message)
+		})
+	}
+}
+
+func TestUploadAllowed(t *testing.T) {
+	const owner, uploader = 1, 2
+	folderID := uint(7)
+
+	tests := []struct {
+		name     string
+		uid      uint
+		uploader uint
+		folderID *uint
+		roles    []types.Role
+		code     int
+	}{
+		{"owner", owner, owner, nil, nil, 0},
+		{"uploader who is still editor", uploader, uploader, &folderID, []types.Role{types.RoleEditor}, 0},
+		{"uploader demoted to viewer", uploader, uploader, &folderID, []types.Role{types.RoleViewer}, 403},
+		{"uploader whose grant was revoked", uploader, uploader, &folderID, nil, 403},
+		{"editor who didn't start the upload", 3, uploader, &folderID, []types.Role{types.RoleEditor}, 403},
+		{"upload at the owner's top level", uploader, uploader, nil, []types.Role{types.RoleEditor}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perms := &PermissionService{
+				grants:  &fakeGrants{roles: tt.roles},
+				folders: &fakeFolders{folder: &models.Folder{ID: folderID, UserID: owner}},
+			}
+			s := &UploadService{perms: perms}
+			fu := &models.FileUpload{ID: 1, UserID: owner, UploaderID: tt.uploader, FolderID: tt.folderID}
+			checkAppError(t, s.Allowed(tt.uid, fu), tt.code, "")
+		})
+	}
+}
+
+// checkAppError fails unless err is nil for code 0, or an AppError with
+// code (and message, when set) otherwise.
+func checkAppError(t *testing.T, err error, code int, message string) {
+	t.Helper()
+	if code == 0 {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	ae, ok := err.(*utils.AppError)
+	if !ok {
+		t.Fatalf("err %v, want AppError %d", err, code)
+	}
+	if ae.Code != code || (message != "" && ae.Message != message) {
+		t.Fatalf("err %v, want [%d] %s", ae, code, message)
+	}
+}
+
+// fakeGrants answers RolesOn only; any other call panics.
+type fakeGrants struct {
+	types.IGrantRepository
+	roles []types.Role
+	err   error
+}
+
+func (f *fakeGrants) RolesOn(userID, fileID, folderID uint) ([]types.Role, error) {
+	return f.roles, f.err
+}
+
+// fakeFolders answers Find only.
+type fakeFolders struct {
+	types.IFolderRepository
+	folder *models.Folder
+}
+
+func (f *fakeFolders) Find(id uint) (*models.Folder, error) {
+	if f.folder == nil || f.folder.ID != id {
+		return nil, errors.New("record not found")
+	}
+	return f.folder, nil
+}
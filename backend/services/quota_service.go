@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"file-transfer-backend/config"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"fmt"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ── QuotaService ──────────────────────────────────────────
+//
+// Users.used_bytes counts the completed files a user owns (logical size —
+// deduplicated content still counts for every owner). It is bumped when an
+// upload completes and lowered on permanent delete. Unfinished uploads count
+// with their declared size. An upload's row is inserted by CreateUpload,
+// which checks the quota and inserts under a lock on the user's row, so
+// parallel uploads cannot overshoot. Reserve is the same check without the
+// lock, for failing early before any work is done.
+
+type QuotaService struct {
+	users types.IUserRepository
+	files types.IFileRepository
+	cfg   *config.UploadConfig
+}
+
+func NewQuotaService(users types.IUserRepository, files types.IFileRepository, cfg *config.UploadConfig) types.IQuotaService {
+	return &QuotaService{users: users, files: files, cfg: cfg}
+}
+
+// Limit resolves a user's limit: their own, else the configured default.
+// -1 means unlimited.
+func (s *QuotaService) Limit(q int64) int64 {
+	if q == 0 {
+		q = s.cfg.DefaultQuota
+	}
+	if q <= 0 {
+		return -1
+	}
+	return q
+}
+
+func (s *QuotaService) Reserve(userID uint, size int64) error {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return utils.NewError(fiber.StatusUnauthorized, "user not found")
+	}
+	quota := s.Limit(user.QuotaBytes)
+	if quota < 0 {
+		return nil
+	}
+	inFlight, err := s.files.InFlightBytes(userID)
+	if err != nil {
+		slog.Error("quota: in-flight sum failed", "user", userID, "err", err)
+		return utils.NewError(fiber.StatusInternalServerError, "quota check failed")
+	}
+	if user.UsedBytes+inFlight+size > quota {
+		slog.Warn("quota exceeded", "user", userID, "used", user.UsedBytes, "in_flight", inFlight, "size", size, "quota", quota)
+		return exceeded(quota, user.UsedBytes+inFlight)
+	}
+	return nil
+}
+
+func (s *QuotaService) CreateUpload(f *models.FileUpload) error {
+	return s.Exceeded(s.files.CreateReserved(f, s.Limit), f.UserID, f.FileSize)
+}
+
+func (s *QuotaService) Exceeded(err error, userID uint, size int64) error {
+	var qe *types.QuotaExceeded
+	if errors.As(err, &qe) {
+		slog.Warn("quota exceeded", "user", userID, "used", qe.Used, "in_flight", qe.InFlight, "size", size, "quota", qe.Quota)
+		return exceeded(qe.Quota, qe.Used+qe.InFlight)
+	}
+	return err
+}
+
+// exceeded is the 413 for a quota with taken bytes already spoken for.
+func exceeded(quota, taken int64) error {
+	return utils.NewError(fiber.StatusRequestEntityTooLarge,
+		fmt.Sprintf("storage quota exceeded: %d of %d bytes available", max(quota-taken, 0), quota))
+}
+
+func (s *QuotaService) Add(userID uint, delta int64) {
+	if err := s.users.AddUsage(userID, delta); err != nil {
+		slog.Error("quota: usage update failed", "user", userID, "delta", delta, "err", err)
+	}
+}
+
+func (s *QuotaService) Usage(userID uint) (*types.Usage, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "user not found")
+	}
+	u, err := s.files.UsageByUser(userID)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusInternalServerError, "usage failed")
+	}
+	if u.InFlightBytes, err = s.files.InFlightBytes(userID); err != nil {
+		return nil, utils.NewError(fiber.StatusInternalServerError, "usage failed")
+	}
+	u.UsedBytes      = user.UsedBytes
+	u.QuotaBytes     = s.Limit(user.QuotaBytes)
+	u.AvailableBytes = -1
+	if u.QuotaBytes >= 0 {
+		u.AvailableBytes = max(u.QuotaBytes-u.UsedBytes-u.InFlightBytes, 0)
+	}
+	return u, nil
+}
@@ -2,62 +2,154 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
+	appconfig "file-transfer-backend/config"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-// S3Service handles all file operations with AWS S3.
+// S3Service stores files in an AWS S3 bucket (STORAGE_BACKEND=s3).
 type S3Service struct {
-	client *s3.Client
-	bucket string
+	client    *s3.Client
+	presigner *s3.PresignClient // signs against PublicEndpoint
+	bucket    string
 }
 
 // NewS3Service creates a new S3Service.
 // Call this once at startup and reuse the instance everywhere.
-func NewS3Service(region, accessKey, secretKey, bucket string) (*S3Service, error) {
+//
+// With c.Endpoint set it talks to an S3-compatible server (MinIO, Ceph,
+// LocalStack) instead of AWS. Presigned download URLs are signed for
+// c.PublicEndpoint, which is what the browser can reach — e.g.
+// http://localhost:9000 while the server itself uses http://minio:9000.
+func NewS3Service(c *appconfig.S3Config) (*S3Service, error) {
 	// Create AWS config with explicit credentials from .env
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion(region),
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(c.Region),
 		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(accessKey, secretKey, ""),
+			credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, ""),
 		),
-	)
+	}
+	if c.Endpoint != "" {
+		// Many S3-compatible servers reject the CRC checksums the SDK now
+		// sends by default — only send them when an operation requires it.
+		opts = append(opts,
+			config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired),
+			config.WithResponseChecksumValidation(aws.ResponseChecksumValidationWhenRequired),
+		)
+	}
+	if c.InsecureSkipVerify {
+		opts = append(opts, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{}
+			}
+			tr.TLSClientConfig.InsecureSkipVerify = true
+		})))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
+	client := s3.NewFromConfig(cfg, s3Endpoint(c.Endpoint, c.UsePathStyle))
+	public := client
+	if c.PublicEndpoint != c.Endpoint {
+		public = s3.NewFromConfig(cfg, s3Endpoint(c.PublicEndpoint, c.UsePathStyle))
+	}
+
 	return &S3Service{
-		client: s3.NewFromConfig(cfg),
-		bucket: bucket,
+		client:    client,
+		presigner: s3.NewPresignClient(public),
+		bucket:    c.Bucket,
 	}, nil
 }
 
-// Upload sends a file to S3.
+// s3Endpoint points a client at a custom endpoint; empty keeps AWS.
+func s3Endpoint(endpoint string, pathStyle bool) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = pathStyle
+	}
+}
+
+func (s *S3Service) Name() string { return "s3" }
+
+// Put streams a file to S3.
 //
 //   key      — the path inside the bucket, e.g. "users/42/report.pdf"
-//   data     — raw file bytes
+//   body     — file contents; pass an *os.File so the SDK can seek for signing
+//   size     — exact length of body in bytes
 //   mimeType — content type, e.g. "application/pdf"
-//
-// Returns the S3 key (same as input) so you can store it in the database.
-func (s *S3Service) Upload(ctx context.Context, key string, data []byte, mimeType string) (string, error) {
+func (s *S3Service) Put(ctx context.Context, key string, body io.Reader, size int64, mimeType string) error {
 	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(data),
-		ContentType: aws.String(mimeType),
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(mimeType),
 	})
 	if err != nil {
-		return "", fmt.Errorf("s3 upload failed for key %q: %w", key, err)
+		return fmt.Errorf("s3 upload failed for key %q: %w", key, err)
 	}
-	return key, nil
+	return nil
+}
+
+// Get opens an object for reading. The caller must close it.
+func (s *S3Service) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Err("get", key, err)
+	}
+	return out.Body, nil
+}
+
+// GetRange is a ranged GET; only the requested bytes leave the bucket.
+func (s *S3Service) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, s3Err("get", key, err)
+	}
+	return out.Body, nil
+}
+
+// Stat returns an object's size and modification time without its body.
+func (s *S3Service) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Err("head", key, err)
+	}
+	return &types.ObjectInfo{
+		Key:     key,
+		Size:    aws.ToInt64(out.ContentLength),
+		ModTime: aws.ToTime(out.LastModified),
+	}, nil
 }
 
 // Delete removes a file from S3 permanently.
@@ -72,17 +164,16 @@ func (s *S3Service) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
-// PresignDownload generates a temporary download URL for a file.
+// Presign generates a temporary download URL for a file.
 // The URL is valid for `ttl` duration (e.g. 15 minutes).
 // The Content-Disposition header is embedded in the presigned URL so the
-// browser saves the file with the original filename regardless of the S3 key.
-func (s *S3Service) PresignDownload(ctx context.Context, key string, fileName string, ttl time.Duration) (string, error) {
-	presigner := s3.NewPresignClient(s.client)
-
-	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+// browser saves the file with the original filename regardless of the S3 key;
+// S3 echoes it back verbatim, so it is encoded here like every other one.
+func (s *S3Service) Presign(ctx context.Context, key string, fileName string, ttl time.Duration) (string, error) {
+	req, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket:                     aws.String(s.bucket),
 		Key:                        aws.String(key),
-		ResponseContentDisposition: aws.String(`attachment; filename="` + fileName + `"`),
+		ResponseContentDisposition: aws.String(utils.ContentDisposition("attachment", fileName)),
 	}, s3.WithPresignExpires(ttl))
 	if err != nil {
 		return "", fmt.Errorf("failed to presign download for key %q: %w", key, err)
@@ -91,14 +182,183 @@ func (s *S3Service) PresignDownload(ctx context.Context, key string, fileName st
 	return req.URL, nil
 }
 
-// BuildKey creates a consistent S3 key for a user's file.
-//
-// Examples:
-//   BuildKey(42, 0,  "report.pdf")         → "users/42/report.pdf"
-//   BuildKey(42, 7,  "docs/notes.txt")     → "users/42/folders/7/docs/notes.txt"
-func BuildKey(userID uint, folderID uint, relPath string) string {
-	if folderID == 0 {
-		return fmt.Sprintf("users/%d/%s", userID, relPath)
-	}
-	return fmt.Sprintf("users/%d/folders/%d/%s", userID, folderID, relPath)
-}
\ No newline at end of file
+// List returns every object whose key starts with prefix, following
+// continuation tokens until the listing is exhausted.
+func (s *S3Service) List(ctx context.Context, prefix string) ([]types.ObjectInfo, error) {
+	var out []types.ObjectInfo
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list failed for prefix %q: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			out = append(out, types.ObjectInfo{
+				Key:     aws.ToString(obj.Key),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return out, nil
+}
+
+// ─── Copy ─────────────────────────────────────────────────────────────────────
+
+const (
+	maxCopyObjectSize = 5 << 30   // CopyObject limit
+	copyPartSize      = 512 << 20 // part size above it (10 000 parts ≈ 5 TiB)
+)
+
+// Copy duplicates an object inside the bucket without downloading it.
+// Objects above 5 GiB are copied part by part with UploadPartCopy.
+func (s *S3Service) Copy(ctx context.Context, src, dst string) error {
+	info, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	source := aws.String(url.PathEscape(s.bucket + "/" + src))
+	if info.Size <= maxCopyObjectSize {
+		_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(dst),
+			CopySource: source,
+		})
+		if err != nil {
+			return fmt.Errorf("s3 copy failed from %q to %q: %w", src, dst, err)
+		}
+		return nil
+	}
+
+	uploadID, err := s.CreateMultipart(ctx, dst, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	var parts []types.StoredPart
+	for off, n := int64(0), 1; off < info.Size; off, n = off+copyPartSize, n+1 {
+		end := min(off+copyPartSize, info.Size) - 1
+		out, err := s.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(dst),
+			UploadId:        aws.String(uploadID),
+			PartNumber:      aws.Int32(int32(n)),
+			CopySource:      source,
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", off, end)),
+		})
+		if err != nil {
+			s.AbortMultipart(ctx, dst, uploadID)
+			return fmt.Errorf("s3 copy part %d failed from %q to %q: %w", n, src, dst, err)
+		}
+		parts = append(parts, types.StoredPart{Number: n, ETag: aws.ToString(out.CopyPartResult.ETag), Size: end - off + 1})
+	}
+	if err := s.CompleteMultipart(ctx, dst, uploadID, parts); err != nil {
+		s.AbortMultipart(ctx, dst, uploadID)
+		return err
+	}
+	return nil
+}
+
+// ─── Multipart ────────────────────────────────────────────────────────────────
+
+// CreateMultipart starts a multipart upload and returns its upload ID.
+func (s *S3Service) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	out, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 create multipart failed for key %q: %w", key, err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// UploadPart sends one part (1-based number). Re-sending a number replaces it.
+func (s *S3Service) UploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (string, error) {
+	out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(int32(number)),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 upload part %d failed for key %q: %w", number, key, err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// ListParts returns the parts S3 already holds for an unfinished upload.
+func (s *S3Service) ListParts(ctx context.Context, key, uploadID string) ([]types.StoredPart, error) {
+	var parts []types.StoredPart
+	in := &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}
+	for {
+		out, err := s.client.ListParts(ctx, in)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list parts failed for key %q: %w", key, err)
+		}
+		for _, p := range out.Parts {
+			parts = append(parts, types.StoredPart{
+				Number: int(aws.ToInt32(p.PartNumber)),
+				ETag:   aws.ToString(p.ETag),
+				Size:   aws.ToInt64(p.Size),
+			})
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			return parts, nil
+		}
+		in.PartNumberMarker = out.NextPartNumberMarker
+	}
+}
+
+// CompleteMultipart assembles the object from parts (ascending numbers).
+func (s *S3Service) CompleteMultipart(ctx context.Context, key, uploadID string, parts []types.StoredPart) error {
+	completed := make([]s3types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completed[i] = s3types.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int32(int32(p.Number)),
+		}
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("s3 complete multipart failed for key %q: %w", key, err)
+	}
+	return nil
+}
+
+// AbortMultipart discards an unfinished upload and every part stored for it.
+func (s *S3Service) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 abort multipart failed for key %q: %w", key, err)
+	}
+	return nil
+}
+
+// s3Err maps S3's "no such key" errors onto ErrObjectNotFound.
+func s3Err(op, key string, err error) error {
+	var noKey *s3types.NoSuchKey
+	var notFound *s3types.NotFound
+	if errors.As(err, &noKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%q: %w", key, ErrObjectNotFound)
+	}
+	return fmt.Errorf("s3 %s failed for key %q: %w", op, key, err)
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ── ShareService ──────────────────────────────────────────
+//
+// Share links hand a file or folder to someone without an account. The
+// token is 32 random bytes (base64url) and is the only credential; a link
+// may also carry a bcrypt-hashed password, an expiry and a download limit.
+//
+// Every visit is checked in the same order — revoked, expired, used up,
+// password, target still there — and recorded in share_accesses with the
+// first check that failed, or "info". A visit that passes and fetches
+// content is recorded by Served once the handler knows what it sends:
+// "download" for the whole thing (or a range from its first byte),
+// "partial" for a ranged continuation, "not_modified" for a 304. Only a
+// "download" is counted, by an UPDATE that re-checks the link, so resumed
+// downloads and players seeking through a video don't use up the limit and
+// parallel requests can't exceed it. Targets are read as the link's
+// owner would see them: a trashed or unfinished file and a trashed folder
+// are gone for the link too, and a folder is served with its live contents
+// at the time of the visit.
+
+// maxShareAccesses caps how many access records one listing returns.
+const maxShareAccesses = 200
+
+type ShareService struct {
+	shares   types.IShareRepository
+	files    types.IFileRepository
+	folders  types.IFolderRepository
+	archives types.IArchiveService
+}
+
+func NewShareService(shares types.IShareRepository, files types.IFileRepository, folders types.IFolderRepository, archives types.IArchiveService) types.IShareService {
+	return &ShareService{shares: shares, files: files, folders: folders, archives: archives}
+}
+
+func (s *ShareService) Create(uid uint, req types.ShareCreate) (*models.ShareLink, error) {
+	if (req.FileID == nil) == (req.FolderID == nil) {
+		return nil, utils.NewFieldError(fiber.StatusBadRequest, "file_id", "exactly one of file_id and folder_id is required")
+	}
+	if req.FileID != nil {
+		f, err := s.files.GetByID(*req.FileID)
+		if err != nil || f.UserID != uid {
+			return nil, utils.NewFieldError(fiber.StatusNotFound, "file_id", "file not found")
+		}
+		if f.Trashed {
+			return nil, utils.NewFieldError(fiber.StatusConflict, "file_id", "file is in the trash")
+		}
+		if f.Status != "completed" {
+			return nil, utils.NewFieldError(fiber.StatusConflict, "file_id", "only completed files can be shared")
+		}
+	} else {
+		f, err := s.folders.GetByID(*req.FolderID, uid)
+		if err != nil {
+			return nil, utils.NewFieldError(fiber.StatusNotFound, "folder_id", "folder not found")
+		}
+		if f.Trashed {
+			return nil, utils.NewFieldError(fiber.StatusConflict, "folder_id", "folder is in the trash")
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, utils.NewFieldError(fiber.StatusBadRequest, "expires_at", "expires_at must be in the future")
+	}
+	if req.MaxDownloads < 0 {
+		return nil, utils.NewFieldError(fiber.StatusBadRequest, "max_downloads", "max_downloads must not be negative")
+	}
+
+	link := &models.ShareLink{
+		UserID:       uid,
+		FileUploadID: req.FileID,
+		FolderID:     req.FolderID,
+		ExpiresAt:    req.ExpiresAt,
+		MaxDownloads: req.MaxDownloads,
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return nil, utils.NewFieldError(fiber.StatusBadRequest, "password", "password must be at most 72 bytes")
+		}
+		if err != nil {
+			return nil, utils.NewError(fiber.StatusInternalServerError, "hash password")
+		}
+		link.Password = string(hash)
+	}
+	token, err := newShareToken()
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusInternalServerError, "generate token")
+	}
+	link.Token = token
+	if err := s.shares.Create(link); err != nil {
+		slog.Error("share: create failed", "user", uid, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "create share link failed")
+	}
+	link.HasPassword = link.Password != ""
+	slog.Info("🔗 share link created",
+		"id",            link.ID,
+		"user",          uid,
+		"file_id",       link.FileUploadID,
+		"folder_id",     link.FolderID,
+		"password",      link.HasPassword,
+		"expires_at",    link.ExpiresAt,
+		"max_downloads", link.MaxDownloads,
+	)
+	return link, nil
+}
+
+func (s *ShareService) List(uid uint, fileID, folderID *uint) ([]models.ShareLink, error) {
+	links, err := s.shares.ListByUser(uid, fileID, folderID)
+	if err != nil {
+		slog.Error("share: list failed", "user", uid, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "list failed")
+	}
+	for i := range links {
+		links[i].HasPassword = links[i].Password != ""
+	}
+	return links, nil
+}
+
+func (s *ShareService) link(uid, id uint) (*models.ShareLink, error) {
+	l, err := s.shares.GetByID(id)
+	if err != nil || l.UserID != uid {
+		return nil, utils.NewError(fiber.StatusNotFound, "share link not found")
+	}
+	return l, nil
+}
+
+// Revoke disables a link for good; its access log is kept.
+func (s *ShareService) Revoke(uid, id uint) error {
+	l, err := s.link(uid, id)
+	if err != nil {
+		return err
+	}
+	if l.RevokedAt != nil {
+		return nil
+	}
+	if err := s.shares.Revoke(id, time.Now()); err != nil {
+		slog.Error("share: revoke failed", "id", id, "err", err)
+		return utils.NewError(fiber.StatusInternalServerError, "revoke failed")
+	}
+	slog.Info("share link revoked", "id", id, "user", uid)
+	return nil
+}
+
+func (s *ShareService) Accesses(uid, id uint) ([]models.ShareAccess, error) {
+	if _, err := s.link(uid, id); err != nil {
+		return nil, err
+	}
+	accesses, err := s.shares.ListAccesses(id, maxShareAccesses)
+	if err != nil {
+		slog.Error("share: access list failed", "id", id, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "list failed")
+	}
+	return accesses, nil
+}
+
+func (s *ShareService) Open(v types.ShareVisit) (*types.SharedItem, error) {
+	link, err := s.shares.GetByToken(v.Token)
+	if err != nil {
+		slog.Warn("share: unknown token", "ip", v.IP)
+		return nil, utils.NewError(fiber.StatusNotFound, "link not found")
+	}
+
+	now := time.Now()
+	switch {
+	case link.RevokedAt != nil:
+		return nil, s.deny(link, v, "revoked", utils.NewError(fiber.StatusGone, "link has been revoked"))
+	case link.ExpiresAt != nil && !link.ExpiresAt.After(now):
+		return nil, s.deny(link, v, "expired", utils.NewError(fiber.StatusGone, "link has expired"))
+	case link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads:
+		return nil, s.deny(link, v, "exhausted", utils.NewError(fiber.StatusGone, "download limit reached"))
+	}
+	if link.Password != "" {
+		if v.Password == "" {
+			return nil, s.deny(link, v, "password_required", utils.NewFieldError(fiber.StatusUnauthorized, "password", "password required"))
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.Password), []byte(v.Password)) != nil {
+			return nil, s.deny(link, v, "wrong_password", utils.NewFieldError(fiber.StatusForbidden, "password", "wrong password"))
+		}
+	}
+
+	item, err := s.target(link)
+	if err != nil {
+		var ae *utils.AppError
+		if errors.As(err, &ae) && ae.Code == fiber.StatusNotFound {
+			return nil, s.deny(link, v, "gone", utils.NewError(fiber.StatusNotFound, "shared item is no longer available"))
+		}
+		return nil, err
+	}
+
+	if !v.Download {
+		s.record(link, v, "info")
+	}
+	return item, nil
+}
+
+func (s *ShareService) Served(item *types.SharedItem, v types.ShareVisit, outcome string) error {
+	link := item.Link
+	if outcome == "download" {
+		ok, err := s.shares.CountDownload(link.ID, time.Now())
+		if err != nil {
+			slog.Error("share: counting download failed", "id", link.ID, "err", err)
+			return utils.NewError(fiber.StatusInternalServerError, "download failed")
+		}
+		if !ok {
+			return s.deny(link, v, "exhausted", utils.NewError(fiber.StatusGone, "download limit reached"))
+		}
+	}
+	s.record(link, v, outcome)
+	return nil
+}
+
+// target loads what the link points at, as its owner would see it now.
+func (s *ShareService) target(link *models.ShareLink) (*types.SharedItem, error) {
+	if link.FileUploadID != nil {
+		f, err := s.files.GetByID(*link.FileUploadID)
+		if err != nil || f.UserID != link.UserID || f.Trashed || f.Status != "completed" {
+			return nil, utils.NewError(fiber.StatusNotFound, "file not found")
+		}
+		return &types.SharedItem{Link: link, Name: f.FileName, File: f}, nil
+	}
+	name, entries, err := s.archives.Folder(link.UserID, *link.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.SharedItem{Link: link, Name: name, Entries: entries}, nil
+}
+
+// deny records a refused visit and returns err.
+func (s *ShareService) deny(link *models.ShareLink, v types.ShareVisit, outcome string, err error) error {
+	s.record(link, v, outcome)
+	return err
+}
+
+func (s *ShareService) record(link *models.ShareLink, v types.ShareVisit, outcome string) {
+	ua := v.UserAgent
+	if len(ua) > 512 {
+		ua = strings.ToValidUTF8(ua[:512], "")
+	}
+	a := &models.ShareAccess{ShareLinkID: link.ID, Outcome: outcome, IP: v.IP, UserAgent: ua}
+	if err := s.shares.LogAccess(a); err != nil {
+		slog.Warn("share: recording access failed", "id", link.ID, "outcome", outcome, "err", err)
+	}
+	slog.Info("🔗 share link visited", "id", link.ID, "outcome", outcome, "ip", v.IP)
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
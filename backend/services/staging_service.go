@@ -0,0 +1,438 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ── StagingService ────────────────────────────────────────
+//
+// StagingService spools in-flight uploads to disk so server memory stays flat
+// no matter how large the file is. Every upload owns:
+//
+//	<dir>/<id>.part     chunks 0..next-1 appended in order, hashed as written
+//	<dir>/<id>.d/<n>    chunks that arrived ahead of their turn
+//
+// Out-of-order chunks are drained into the .part file as soon as the gap in
+// front of them is filled, so the SHA-256 is always computed incrementally
+// over the bytes in their final order. At most one chunk is held in RAM.
+//
+// Nothing here depends on process memory surviving: after a disconnect or a
+// restart, Resume rebuilds the state from the files on disk and the
+// file_chunks rows that were recorded for each accepted chunk.
+
+var (
+	// ErrNotStaged means the upload has no open staging state in this process —
+	// typically after a disconnect or restart. Resume/Reopen reattach it.
+	ErrNotStaged = errors.New("upload is not staged")
+	// ErrOffsetMismatch means an Append did not start at the current size.
+	ErrOffsetMismatch = errors.New("offset does not match staged size")
+	// ErrChecksumMismatch means appended bytes failed their checksum and were
+	// rolled back.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+type StagingService struct {
+	dir     string
+	mu      sync.Mutex
+	uploads map[uint]*stagedUpload
+	attach  map[uint]*attachLock // per-upload lock around Resume and Reopen
+}
+
+type attachLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+type stagedUpload struct {
+	mu      sync.Mutex
+	f       *os.File
+	hash    hash.Hash
+	size    int64
+	next    int              // index of the next chunk to append to .part
+	pending map[int]struct{} // chunks spooled in .d waiting for their turn
+}
+
+func NewStagingService(dir string) (types.IStagingService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("staging dir %q: %w", dir, err)
+	}
+	return &StagingService{dir: dir, uploads: map[uint]*stagedUpload{}, attach: map[uint]*attachLock{}}, nil
+}
+
+func (s *StagingService) partPath(id uint) string { return filepath.Join(s.dir, fmt.Sprintf("%d.part", id)) }
+func (s *StagingService) spoolDir(id uint) string { return filepath.Join(s.dir, fmt.Sprintf("%d.d", id)) }
+
+// Begin creates an empty staging file for a new upload.
+func (s *StagingService) Begin(id uint) error {
+	f, err := os.OpenFile(s.partPath(id), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create staging file: %w", err)
+	}
+	s.mu.Lock()
+	s.uploads[id] = &stagedUpload{f: f, hash: sha256.New(), pending: map[int]struct{}{}}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *StagingService) get(id uint) (*stagedUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("upload %d: %w", id, ErrNotStaged)
+	}
+	return u, nil
+}
+
+// lockAttach serializes reattaching one upload. Concurrent requests that all
+// found it unstaged take turns: the first reopens it from disk and the others
+// find it open, instead of closing and truncating a file another request is
+// writing to. The returned func releases the lock.
+func (s *StagingService) lockAttach(id uint) func() {
+	s.mu.Lock()
+	l, ok := s.attach[id]
+	if !ok {
+		l = &attachLock{}
+		s.attach[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.attach, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// WriteChunk stores one verified chunk and returns how many distinct chunks
+// have been received so far. Re-sending a chunk that is already staged is a
+// no-op, so clients can safely retry.
+func (s *StagingService) WriteChunk(id uint, index int, data []byte) (int, error) {
+	u, err := s.get(id)
+	if err != nil {
+		return 0, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, dup := u.pending[index]; dup || index < u.next {
+		return u.next + len(u.pending), nil
+	}
+
+	if index > u.next {
+		if err := os.MkdirAll(s.spoolDir(id), 0o755); err != nil {
+			return 0, fmt.Errorf("spool dir: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(s.spoolDir(id), strconv.Itoa(index)), data, 0o644); err != nil {
+			return 0, fmt.Errorf("spool chunk %d: %w", index, err)
+		}
+		u.pending[index] = struct{}{}
+		return u.next + len(u.pending), nil
+	}
+
+	if err := u.append(data); err != nil {
+		return 0, fmt.Errorf("append chunk %d: %w", index, err)
+	}
+	if err := s.drain(id, u); err != nil {
+		return 0, err
+	}
+	return u.next + len(u.pending), nil
+}
+
+func (u *stagedUpload) append(data []byte) error {
+	if _, err := u.f.Write(data); err != nil {
+		return err
+	}
+	u.hash.Write(data)
+	u.size += int64(len(data))
+	u.next++
+	return nil
+}
+
+// drain moves spooled chunks into the .part file while they are contiguous.
+func (s *StagingService) drain(id uint, u *stagedUpload) error {
+	for {
+		idx := u.next
+		if _, ok := u.pending[idx]; !ok {
+			return nil
+		}
+		p := filepath.Join(s.spoolDir(id), strconv.Itoa(idx))
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read spooled chunk %d: %w", idx, err)
+		}
+		delete(u.pending, idx)
+		if err := u.append(data); err != nil {
+			return fmt.Errorf("append spooled chunk %d: %w", idx, err)
+		}
+		os.Remove(p)
+	}
+}
+
+// Append streams r onto the end of the staging file for offset-addressed
+// (tus) uploads; offset must equal the current staged size. When check is
+// non-nil the appended bytes must hash to want — otherwise they are rolled
+// back, together with the running SHA-256, and ErrChecksumMismatch is
+// returned. Returns the new staged size.
+func (s *StagingService) Append(id uint, offset int64, r io.Reader, check hash.Hash, want []byte) (int64, error) {
+	u, err := s.get(id)
+	if err != nil {
+		return 0, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if offset != u.size {
+		return u.size, ErrOffsetMismatch
+	}
+	state, err := u.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return u.size, fmt.Errorf("snapshot hash: %w", err)
+	}
+
+	w := io.MultiWriter(u.f, u.hash)
+	if check != nil {
+		w = io.MultiWriter(u.f, u.hash, check)
+	}
+	n, err := io.Copy(w, r)
+	if err == nil && check != nil && !bytes.Equal(check.Sum(nil), want) {
+		err = ErrChecksumMismatch
+	}
+	if err != nil {
+		if terr := u.f.Truncate(u.size); terr != nil {
+			return u.size, fmt.Errorf("rollback: %w", terr)
+		}
+		u.f.Seek(u.size, io.SeekStart)
+		u.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+		return u.size, err
+	}
+	u.size += n
+	return u.size, nil
+}
+
+// Reopen reattaches an offset-addressed upload from disk, keeping every byte
+// already staged, and returns the staged size. It is a no-op when the upload
+// is already open in this process.
+func (s *StagingService) Reopen(id uint) (int64, error) {
+	defer s.lockAttach(id)()
+	if u, err := s.get(id); err == nil {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return u.size, nil
+	}
+
+	f, err := os.OpenFile(s.partPath(id), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("open staging file: %w", err)
+	}
+	u := &stagedUpload{f: f, hash: sha256.New(), pending: map[int]struct{}{}}
+	if u.size, err = io.Copy(u.hash, f); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("rehash staging file: %w", err)
+	}
+
+	s.mu.Lock()
+	s.uploads[id] = u
+	s.mu.Unlock()
+	return u.size, nil
+}
+
+// Path is where the contiguous staged bytes of an upload live.
+func (s *StagingService) Path(id uint) string { return s.partPath(id) }
+
+// Size returns how many contiguous bytes are staged for an open upload.
+func (s *StagingService) Size(id uint) (int64, error) {
+	u, err := s.get(id)
+	if err != nil {
+		return 0, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.size, nil
+}
+
+// Finish closes the staging file once all `total` chunks are in and returns
+// its location, size and SHA-256. The caller owns the file afterwards and must
+// move or remove it.
+func (s *StagingService) Finish(id uint, total int) (*types.StagedFile, error) {
+	u, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.next < total {
+		return nil, fmt.Errorf("missing chunk %d", u.next)
+	}
+	if err := u.f.Close(); err != nil {
+		return nil, fmt.Errorf("close staging file: %w", err)
+	}
+	os.RemoveAll(s.spoolDir(id))
+
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+
+	return &types.StagedFile{
+		Path:     s.partPath(id),
+		Size:     u.size,
+		Checksum: hex.EncodeToString(u.hash.Sum(nil)),
+	}, nil
+}
+
+// Resume reopens a staged upload from disk. `recorded` are the file_chunks
+// rows persisted for the upload; only chunks that are both recorded and
+// actually present on disk are kept. Bytes past the last recorded chunk (a
+// crash between the write and the DB insert) are truncated away and the hash
+// is recomputed over what remains. Returns the indices the server now holds.
+// An upload already open in this process is left as it is: its state is what
+// is on disk, and another request may be writing to it.
+func (s *StagingService) Resume(id uint, recorded []models.FileChunk) ([]int, error) {
+	defer s.lockAttach(id)()
+	if u, err := s.get(id); err == nil {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return u.held(), nil
+	}
+
+	f, err := os.OpenFile(s.partPath(id), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open staging file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat staging file: %w", err)
+	}
+
+	sizes := map[int]int64{}
+	for _, ch := range recorded {
+		sizes[ch.ChunkIndex] = int64(ch.ChunkSize)
+	}
+
+	u := &stagedUpload{f: f, hash: sha256.New(), pending: map[int]struct{}{}}
+	for {
+		n, ok := sizes[u.next]
+		if !ok || u.size+n > info.Size() {
+			break
+		}
+		u.size += n
+		u.next++
+	}
+
+	if err := f.Truncate(u.size); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("truncate staging file: %w", err)
+	}
+	if _, err := io.Copy(u.hash, io.NewSectionReader(f, 0, u.size)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("rehash staging file: %w", err)
+	}
+	if _, err := f.Seek(u.size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seek staging file: %w", err)
+	}
+
+	entries, _ := os.ReadDir(s.spoolDir(id))
+	for _, e := range entries {
+		p := filepath.Join(s.spoolDir(id), e.Name())
+		idx, err := strconv.Atoi(e.Name())
+		n, ok := sizes[idx]
+		info, statErr := e.Info()
+		if err != nil || !ok || idx < u.next || statErr != nil || info.Size() != n {
+			os.Remove(p)
+			continue
+		}
+		u.pending[idx] = struct{}{}
+	}
+	have := u.held()
+
+	s.mu.Lock()
+	s.uploads[id] = u
+	s.mu.Unlock()
+
+	if err := s.drain(id, u); err != nil {
+		return nil, err
+	}
+	return have, nil
+}
+
+// held lists the chunk indices staged for u, in order.
+func (u *stagedUpload) held() []int {
+	have := make([]int, 0, u.next+len(u.pending))
+	for i := 0; i < u.next; i++ {
+		have = append(have, i)
+	}
+	for idx := range u.pending {
+		have = append(have, idx)
+	}
+	sort.Ints(have)
+	return have
+}
+
+// Suspend closes the staging file and forgets the in-memory state but keeps
+// everything on disk, so the upload can be picked up later with Resume.
+func (s *StagingService) Suspend(id uint) {
+	s.mu.Lock()
+	u, ok := s.uploads[id]
+	delete(s.uploads, id)
+	s.mu.Unlock()
+
+	if ok {
+		u.mu.Lock()
+		u.f.Close()
+		u.mu.Unlock()
+	}
+}
+
+// List returns the ids of every upload with a staging file or spool dir.
+// Entries that are not named after an upload id are ignored.
+func (s *StagingService) List() ([]uint, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[uint]bool{}
+	var ids []uint
+	for _, e := range entries {
+		name := strings.TrimSuffix(strings.TrimSuffix(e.Name(), ".part"), ".d")
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || name == e.Name() || seen[uint(id)] {
+			continue
+		}
+		seen[uint(id)] = true
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// Discard drops everything staged for an upload.
+func (s *StagingService) Discard(id uint) error {
+	s.Suspend(id)
+	os.RemoveAll(s.spoolDir(id))
+	if err := os.Remove(s.partPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"errors"
+	"file-transfer-backend/config"
+	"file-transfer-backend/types"
+	"fmt"
+)
+
+// ── Storage ───────────────────────────────────────────────
+//
+// Finished files live behind types.IStorage. Handlers and the upload service
+// only ever see the interface; NewStorage is the one place that knows which
+// backends exist, so adding one means a new file plus a case below.
+
+// ErrObjectNotFound is returned (wrapped) by Get and Stat for missing keys.
+var ErrObjectNotFound = errors.New("object not found")
+
+// NewStorage builds the backend selected by STORAGE_BACKEND.
+func NewStorage(cfg *config.Config) (types.IStorage, error) {
+	switch cfg.Storage.Backend {
+	case "local":
+		return NewLocalStorage(cfg.Upload.Directory)
+	case "memory":
+		return NewMemoryStorage(), nil
+	case "s3":
+		if cfg.S3.Bucket == "" {
+			return nil, errors.New("STORAGE_BACKEND=s3 requires AWS_S3_BUCKET")
+		}
+		s3Svc, err := NewS3Service(&cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		return s3Svc, nil
+	}
+	return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (want local, s3 or memory)", cfg.Storage.Backend)
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"errors"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ── TrashService ──────────────────────────────────────────
+//
+// Trashing a folder takes its whole subtree down with it: every folder and
+// file below that is not already in the trash is marked trashed with
+// trash_root_id pointing at the folder, which hides it from every listing.
+// Restoring the folder brings back exactly those items; anything the user
+// trashed on its own stays in the trash.
+//
+// An item whose parent is still in the trash cannot be restored in place —
+// the client has to pick a destination (folder_id / parent_id, null = root).
+//
+// Permanent deletes (empty trash, retention) remove the rows in one
+// transaction per item and hand the stored bytes to a delete_objects job.
+
+type TrashService struct {
+	files   types.IFileRepository
+	folders types.IFolderRepository
+	blobs   types.IBlobService
+}
+
+func NewTrashService(files types.IFileRepository, folders types.IFolderRepository, blobs types.IBlobService) types.ITrashService {
+	return &TrashService{files: files, folders: folders, blobs: blobs}
+}
+
+func (s *TrashService) file(uid, id uint) (*models.FileUpload, error) {
+	f, err := s.files.GetByID(id)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "not found")
+	}
+	if f.UserID != uid {
+		return nil, utils.NewError(fiber.StatusForbidden, "forbidden")
+	}
+	return f, nil
+}
+
+// destination checks a folder chosen to restore into; nil is the root.
+func (s *TrashService) destination(uid uint, field string, id *uint) error {
+	if id == nil {
+		return nil
+	}
+	f, err := s.folders.GetByID(*id, uid)
+	if err != nil {
+		return utils.NewFieldError(fiber.StatusNotFound, field, "folder not found")
+	}
+	if f.Trashed {
+		return utils.NewFieldError(fiber.StatusConflict, field, "folder is in the trash")
+	}
+	return nil
+}
+
+// inTrash reports whether the folder an item sits in is trashed. A parent
+// that no longer exists counts as not trashed; the item goes to the root.
+func (s *TrashService) inTrash(uid uint, parentID *uint) (trashed, gone bool) {
+	if parentID == nil {
+		return false, false
+	}
+	p, err := s.folders.GetByID(*parentID, uid)
+	if err != nil {
+		return false, true
+	}
+	return p.Trashed, false
+}
+
+func (s *TrashService) TrashFile(uid, id uint) error {
+	f, err := s.file(uid, id)
+	if err != nil {
+		return err
+	}
+	if err := s.files.Trash(f.ID); err != nil {
+		slog.Error("trash file", "file_id", id, "err", err)
+		return utils.NewError(fiber.StatusInternalServerError, "update failed")
+	}
+	slog.Info("file trashed", "file_id", id, "user", uid)
+	return nil
+}
+
+func (s *TrashService) RestoreFile(uid, id uint, dest *uint, move bool) (*models.FileUpload, error) {
+	f, err := s.file(uid, id)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Trashed {
+		return f, nil
+	}
+	if move {
+		if err := s.destination(uid, "folder_id", dest); err != nil {
+			return nil, err
+		}
+	} else if trashed, gone := s.inTrash(uid, f.FolderID); trashed {
+		return nil, utils.NewFieldError(fiber.StatusConflict, "folder_id",
+			"the file's folder is in the trash — restore the folder or choose a folder_id")
+	} else if gone {
+		move = true
+	}
+
+	if err := s.files.Restore(f.ID, dest, move); err != nil {
+		slog.Error("restore file", "file_id", id, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "update failed")
+	}
+	slog.Info("file restored", "file_id", id, "user", uid)
+	return s.files.GetByID(id)
+}
+
+func (s *TrashService) TrashFolder(uid, id uint) error {
+	f, err := s.folders.GetByID(id, uid)
+	if err != nil {
+		return utils.NewError(fiber.StatusNotFound, "folder not found")
+	}
+	if f.Trashed {
+		return nil
+	}
+	if err := s.folders.TrashTree(id, uid); err != nil {
+		slog.Error("trash folder", "id", id, "err", err)
+		return utils.NewError(fiber.StatusInternalServerError, "update failed")
+	}
+	slog.Info("folder trashed", "id", id, "user", uid)
+	return nil
+}
+
+func (s *TrashService) RestoreFolder(uid, id uint, dest *uint, move bool) (*models.Folder, error) {
+	f, err := s.folders.GetByID(id, uid)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "folder not found")
+	}
+	if !f.Trashed {
+		return f, nil
+	}
+	if move {
+		if err := s.destination(uid, "parent_id", dest); err != nil {
+			return nil, err
+		}
+	} else if trashed, gone := s.inTrash(uid, f.ParentID); trashed {
+		return nil, utils.NewFieldError(fiber.StatusConflict, "parent_id",
+			"the parent folder is in the trash — restore it or choose a parent_id")
+	} else if gone {
+		move = true
+	}
+
+	if err := s.folders.RestoreTree(id, uid, dest, move); err != nil {
+		slog.Error("restore folder", "id", id, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "update failed")
+	}
+	slog.Info("folder restored", "id", id, "user", uid)
+	return s.folders.GetByID(id, uid)
+}
+
+// ─── Batch restore ────────────────────────────────────────────────────────────
+
+func (s *TrashService) RestoreBatch(uid uint, files, folders []uint, dest *uint, move bool) *types.TrashRestore {
+	res := &types.TrashRestore{Files: []models.FileUpload{}, Folders: []models.Folder{}, Failed: []types.TrashFailure{}}
+	fail := func(kind string, id uint, err error) {
+		var ae *utils.AppError
+		msg := err.Error()
+		if errors.As(err, &ae) {
+			msg = ae.Message
+		}
+		res.Failed = append(res.Failed, types.TrashFailure{Kind: kind, ID: id, Error: msg})
+	}
+
+	// Folders first, so files inside them can come back in place
+	for _, id := range folders {
+		f, err := s.RestoreFolder(uid, id, dest, move)
+		if err != nil {
+			fail("folder", id, err)
+			continue
+		}
+		res.Folders = append(res.Folders, *f)
+	}
+	for _, id := range files {
+		f, err := s.RestoreFile(uid, id, dest, move)
+		if err != nil {
+			fail("file", id, err)
+			continue
+		}
+		res.Files = append(res.Files, *f)
+	}
+	return res
+}
+
+// ─── Permanent delete ─────────────────────────────────────────────────────────
+
+func (s *TrashService) Empty(uid uint) (*types.Deletion, error) {
+	total := &types.Deletion{}
+	folders, err := s.folders.ListTrashed(uid)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusInternalServerError, "list failed")
+	}
+	for _, f := range folders {
+		if err := s.deleteFolder(f, total); err != nil {
+			return total, utils.NewError(fiber.StatusInternalServerError, "delete failed")
+		}
+	}
+
+	files, err := s.files.ListTrashed(uid)
+	if err != nil {
+		return total, utils.NewError(fiber.StatusInternalServerError, "list failed")
+	}
+	if err := s.deleteFiles(uid, files, total); err != nil {
+		return total, utils.NewError(fiber.StatusInternalServerError, "delete failed")
+	}
+	slog.Info("🗑  trash emptied", "user", uid, "folders", total.Folders, "files", total.Files, "bytes", total.Bytes)
+	return total, nil
+}
+
+func (s *TrashService) PurgeExpired(before time.Time) (*types.Deletion, error) {
+	total := &types.Deletion{}
+	var errs []error
+
+	folders, err := s.folders.ListTrashedBefore(before)
+	if err != nil {
+		return total, err
+	}
+	for _, f := range folders {
+		errs = append(errs, s.deleteFolder(f, total))
+	}
+
+	// Files inside the folders above are gone already and are skipped
+	files, err := s.files.ListTrashedBefore(before)
+	if err != nil {
+		return total, errors.Join(append(errs, err)...)
+	}
+	byUser := map[uint][]models.FileUpload{}
+	for _, f := range files {
+		byUser[f.UserID] = append(byUser[f.UserID], f)
+	}
+	for uid, fs := range byUser {
+		errs = append(errs, s.deleteFiles(uid, fs, total))
+	}
+	return total, errors.Join(errs...)
+}
+
+func (s *TrashService) deleteFolder(f models.Folder, total *types.Deletion) error {
+	del, err := s.folders.DeleteTree(f.ID, f.UserID)
+	if err != nil {
+		slog.Error("trash: folder delete failed", "id", f.ID, "user", f.UserID, "err", err)
+		return err
+	}
+	s.purge(f.UserID, del, total)
+	return nil
+}
+
+func (s *TrashService) deleteFiles(uid uint, files []models.FileUpload, total *types.Deletion) error {
+	if len(files) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+	del, err := s.files.DeleteFiles(uid, ids)
+	if err != nil {
+		slog.Error("trash: file delete failed", "user", uid, "files", len(ids), "err", err)
+		return err
+	}
+	s.purge(uid, del, total)
+	return nil
+}
+
+// purge queues removal of a deletion's stored objects and adds it to total.
+func (s *TrashService) purge(uid uint, del *types.Deletion, total *types.Deletion) {
+	if err := s.blobs.Purge(uid, del.Objects); err != nil {
+		slog.Error("trash: queueing storage cleanup failed", "user", uid, "objects", len(del.Objects), "err", err)
+	}
+	total.Folders     += del.Folders
+	total.Files       += del.Files
+	total.Bytes       += del.Bytes
+	total.StoredBytes += del.StoredBytes
+}
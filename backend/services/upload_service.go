@@ -0,0 +1,817 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"file-transfer-backend/config"
+	"file-transfer-backend/models"
+	"file-transfer-backend/types"
+	"file-transfer-backend/utils"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ── UploadService ─────────────────────────────────────────
+//
+// UploadService owns the chunked-upload lifecycle shared by the WebSocket and
+// REST transports: init → chunk* → complete, with resume in between. Handlers
+// only decode their framing and call in here, so checksum rules, staging and
+// storage finalization are identical whichever way the bytes arrive.
+//
+// Errors are *utils.AppError so REST handlers can pass them to utils.Respond
+// and the WebSocket handler can forward the message as-is.
+
+type UploadService struct {
+	repo    types.IFileRepository
+	folders types.IFolderRepository
+	cs      types.IChecksumService
+	staging types.IStagingService
+	jobs    types.IJobQueue
+	cfg     *config.UploadConfig
+	store   types.IStorage
+	blobs   types.IBlobService
+	quota   types.IQuotaService
+	perms   types.IPermissionService
+	mp      types.IMultipartUploader // nil = storage has no multipart support
+}
+
+func NewUploadService(
+	repo types.IFileRepository,
+	folders types.IFolderRepository,
+	cs types.IChecksumService,
+	staging types.IStagingService,
+	jobs types.IJobQueue,
+	cfg *config.UploadConfig,
+	store types.IStorage,
+	blobs types.IBlobService,
+	quota types.IQuotaService,
+	perms types.IPermissionService,
+	mp types.IMultipartUploader,
+) types.IUploadService {
+	s := &UploadService{repo: repo, folders: folders, cs: cs, staging: staging, jobs: jobs, cfg: cfg, store: store, blobs: blobs, quota: quota, perms: perms, mp: mp}
+	jobs.Register("store_upload", s.runStore, s.giveUpStore)
+	return s
+}
+
+// Init creates the FileUpload row and an empty staging file. The client's
+// file name and relative path are normalized and the declared size is
+// checked against the owner's quota first, then again when the row is
+// inserted (see create). An upload into a folder shared with uid as editor
+// belongs to the folder's owner and is charged to them; uid stays its
+// uploader and finishes it.
+func (s *UploadService) Init(uid uint, req types.UploadInit) (*models.FileUpload, error) {
+	var err error
+	if req.FileName, err = utils.CleanFileName("file_name", req.FileName); err != nil {
+		return nil, err
+	}
+	if req.RelPath, err = utils.CleanRelPath("rel_path", req.RelPath); err != nil {
+		return nil, err
+	}
+	if req.FileSize < 0 {
+		return nil, utils.NewError(fiber.StatusBadRequest, "invalid file_size")
+	}
+	if req.Checksum != "" && !isSHA256Hex(req.Checksum) {
+		return nil, utils.NewFieldError(fiber.StatusBadRequest, "checksum", "checksum must be 64 lowercase hex characters (SHA-256)")
+	}
+	owner, err := s.owner(uid, req.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quota.Reserve(owner, req.FileSize); err != nil {
+		return nil, err
+	}
+	if req.FolderID, err = s.targetFolder(owner, req); err != nil {
+		return nil, err
+	}
+
+	fu := &models.FileUpload{
+		UserID:      owner,
+		UploaderID:  uid,
+		FolderID:    req.FolderID,
+		FileName:    req.FileName,
+		FileType:    req.FileType,
+		FileSize:    req.FileSize,
+		TotalChunks: req.TotalChunks,
+		Checksum:    req.Checksum,
+		Status:      "pending",
+		RelPath:     req.RelPath,
+	}
+
+	// Content the user already has: reference the stored blob, no bytes
+	// need to be sent
+	if b := s.blobs.ReuseOwned(uid, req.Checksum, req.FileSize); b != nil {
+		fu.Status   = "completed"
+		fu.BlobID   = &b.ID
+		fu.FilePath = b.Key
+		if err := s.create(fu); err != nil {
+			s.blobs.Release(context.Background(), fu)
+			return nil, err
+		}
+		slog.Info("♻  upload deduplicated",
+			"file_id",   fu.ID,
+			"file_name", fu.FileName,
+			"file_size", fu.FileSize,
+			"blob_id",   b.ID,
+			"user",      uid,
+		)
+		return fu, nil
+	}
+
+	if err := s.create(fu); err != nil {
+		return nil, err
+	}
+
+	if err := s.staging.Begin(fu.ID); err != nil {
+		slog.Error("upload init: staging failed", "file_id", fu.ID, "err", err)
+		fu.Status = "failed"
+		s.repo.Update(fu)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "init failed")
+	}
+	s.beginMultipart(fu)
+
+	// ✅ LOG: upload started
+	slog.Info("⬆  upload started",
+		"file_id",   fu.ID,
+		"file_name", fu.FileName,
+		"file_size", fu.FileSize,
+		"user",      uid,
+	)
+	return fu, nil
+}
+
+// isSHA256Hex reports whether s is a SHA-256 digest in lowercase hex — the
+// only form that may go into a storage key.
+func isSHA256Hex(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// create inserts the upload row against its owner's quota. Init's earlier
+// Reserve only fails fast; this is the check that holds under concurrency.
+func (s *UploadService) create(fu *models.FileUpload) error {
+	err := s.quota.CreateUpload(fu)
+	var ae *utils.AppError
+	if errors.As(err, &ae) {
+		return err
+	}
+	if err != nil {
+		slog.Error("upload init: db create failed", "err", err, "user", fu.UserID)
+		return utils.NewError(fiber.StatusInternalServerError, "init failed")
+	}
+	return nil
+}
+
+// owner returns whose drive a new upload lands in: uid's own, or the
+// owner's when folderID is a folder shared with uid as editor.
+func (s *UploadService) owner(uid uint, folderID *uint) (uint, error) {
+	if folderID == nil {
+		return uid, nil
+	}
+	f, err := s.perms.Folder(uid, *folderID, types.RoleEditor)
+	if err != nil {
+		return 0, err
+	}
+	if f.Trashed {
+		return 0, utils.NewFieldError(fiber.StatusConflict, "folder_id", "folder is in the trash")
+	}
+	return f.UserID, nil
+}
+
+// targetFolder resolves the folder a new upload lands in. For directory
+// uploads the folders in its relative path are created in the owner's drive
+// below the chosen folder on the fly: "photos/2024/a.jpg" goes into
+// photos → 2024.
+func (s *UploadService) targetFolder(owner uint, req types.UploadInit) (*uint, error) {
+	dirs := strings.Split(req.RelPath, "/")
+	dirs = dirs[:len(dirs)-1] // last segment is the file itself
+	folderID, err := s.folders.EnsurePath(owner, req.FolderID, dirs)
+	if err != nil {
+		slog.Error("upload init: folder creation failed", "rel_path", req.RelPath, "user", owner, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "init failed")
+	}
+	return folderID, nil
+}
+
+// Allowed checks that uid may carry on with fu: its owner, or the user who
+// started it in a shared folder for as long as they can still edit that
+// folder. A revoked grant or a trashed folder stops the upload with 403.
+func (s *UploadService) Allowed(uid uint, fu *models.FileUpload) error {
+	if fu.UserID == uid {
+		return nil
+	}
+	if fu.UploaderID != uid || fu.FolderID == nil {
+		return utils.NewError(fiber.StatusForbidden, "forbidden")
+	}
+	if _, err := s.perms.Folder(uid, *fu.FolderID, types.RoleEditor); err != nil {
+		slog.Warn("upload: uploader lost access to the folder", "file_id", fu.ID, "folder_id", *fu.FolderID, "user", uid)
+		return utils.NewError(fiber.StatusForbidden, "forbidden")
+	}
+	return nil
+}
+
+// active loads an upload that still accepts chunks and uid may carry on with.
+func (s *UploadService) active(uid, id uint) (*models.FileUpload, error) {
+	fu, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, utils.NewError(fiber.StatusNotFound, "unknown file_upload_id")
+	}
+	if err := s.Allowed(uid, fu); err != nil {
+		return nil, err
+	}
+	if fu.Status != "pending" && fu.Status != "uploading" {
+		return nil, utils.NewError(fiber.StatusConflict, "upload is "+fu.Status)
+	}
+	return fu, nil
+}
+
+// WriteChunk verifies one chunk against its SHA-256, writes it to staging and
+// records it in file_chunks. total may be 0 when the client already declared
+// total_chunks at init. Returns the number of distinct chunks received.
+func (s *UploadService) WriteChunk(uid, id uint, index, total int, checksum string, data []byte) (int, int, error) {
+	if !s.cs.Verify(data, checksum) {
+		slog.Warn("upload chunk: checksum mismatch", "file_id", id, "chunk", index)
+		return 0, 0, utils.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("checksum mismatch chunk %d", index))
+	}
+
+	fu, err := s.active(uid, id)
+	if err != nil {
+		return 0, 0, err
+	}
+	if total == 0 {
+		total = fu.TotalChunks
+	}
+	if total <= 0 || index < 0 || index >= total {
+		return 0, 0, utils.NewError(fiber.StatusBadRequest, fmt.Sprintf("bad chunk index %d of %d", index, total))
+	}
+
+	// Chunk goes straight to the staging file — nothing is retained in memory
+	received, err := s.staging.WriteChunk(id, index, data)
+	if errors.Is(err, ErrNotStaged) {
+		if _, err = s.restage(fu); err == nil {
+			received, err = s.staging.WriteChunk(id, index, data)
+		}
+	}
+	if err != nil {
+		slog.Error("upload chunk: staging write failed", "file_id", id, "chunk", index, "err", err)
+		return 0, 0, utils.NewError(fiber.StatusInternalServerError, fmt.Sprintf("write failed chunk %d", index))
+	}
+
+	// Record the accepted chunk so a resume knows the server already has it
+	if err := s.repo.CreateChunk(&models.FileChunk{
+		FileUploadID: id,
+		ChunkIndex:   index,
+		ChunkSize:    len(data),
+		Checksum:     checksum,
+		Status:       "verified",
+	}); err != nil {
+		slog.Error("upload chunk: record failed", "file_id", id, "chunk", index, "err", err)
+		return 0, 0, utils.NewError(fiber.StatusInternalServerError, fmt.Sprintf("write failed chunk %d", index))
+	}
+
+	if fu.Status != "uploading" || fu.TotalChunks != total {
+		if err := s.markUploading(fu, total); err != nil {
+			return 0, 0, err
+		}
+	} else {
+		s.touch(fu)
+	}
+	s.progress(fu)
+	return received, total, nil
+}
+
+// markUploading moves fu to "uploading" with total chunks, unless a
+// concurrent complete, cancel or expiry got there first.
+func (s *UploadService) markUploading(fu *models.FileUpload, total int) error {
+	ok, err := s.repo.MarkUploading(fu.ID, total)
+	if err != nil {
+		slog.Error("upload: status update failed", "file_id", fu.ID, "err", err)
+		return utils.NewError(fiber.StatusInternalServerError, "write failed")
+	}
+	if !ok {
+		return utils.NewError(fiber.StatusConflict, "upload no longer accepts data")
+	}
+	fu.Status      = "uploading"
+	fu.TotalChunks = total
+	return nil
+}
+
+// touch keeps updated_at — which expiry is measured from — close to the last
+// received byte, writing at most once a minute per upload.
+func (s *UploadService) touch(fu *models.FileUpload) {
+	if time.Since(fu.UpdatedAt) > time.Minute {
+		s.repo.Touch(fu.ID)
+	}
+}
+
+// ─── Multipart streaming ─────────────────────────────────────────────────────
+//
+// Uploads larger than one part are streamed to multipart storage (S3) while
+// they arrive, so complete only has to send the tail. The multipart upload
+// ID lives on the FileUpload row; everything else is recoverable from the
+// staging file and the parts storage already holds.
+
+// storageKey is where a finished upload is stored.
+func (s *UploadService) storageKey(fu *models.FileUpload) string {
+	if fu.MultipartKey != "" {
+		return fu.MultipartKey
+	}
+	return s.blobs.Key(fu)
+}
+
+// beginMultipart opens a multipart upload for large files whose checksum —
+// and so blob key — is known up front. Failure is not fatal: the file is
+// then sent in one go once complete.
+func (s *UploadService) beginMultipart(fu *models.FileUpload) {
+	if s.mp == nil || fu.Checksum == "" || fu.FileSize <= s.mp.PartSize() {
+		return
+	}
+	key := s.storageKey(fu)
+	uploadID, err := s.mp.Begin(context.Background(), key, fu.FileType)
+	if err != nil {
+		slog.Warn("upload init: multipart unavailable — will upload on complete", "file_id", fu.ID, "err", err)
+		return
+	}
+	fu.MultipartID  = uploadID
+	fu.MultipartKey = key
+	s.repo.Update(fu)
+}
+
+// progress hands every newly completed part of the staged prefix to the
+// multipart uploader.
+func (s *UploadService) progress(fu *models.FileUpload) {
+	if s.mp == nil || fu.MultipartID == "" {
+		return
+	}
+	if size, err := s.staging.Size(fu.ID); err == nil {
+		s.mp.Progress(fu.ID, fu.MultipartKey, fu.MultipartID, s.staging.Path(fu.ID), size)
+	}
+}
+
+// abortMultipart discards the parts of an upload that will never complete.
+func (s *UploadService) abortMultipart(fu *models.FileUpload) {
+	if s.mp == nil || fu.MultipartID == "" {
+		return
+	}
+	s.mp.Abort(context.Background(), fu.ID, fu.MultipartKey, fu.MultipartID)
+	fu.MultipartID = ""
+	s.repo.Update(fu)
+}
+
+// restage reattaches the staging file of an upload that is not open in this
+// process (new connection, restart) and drops chunk rows whose bytes did not
+// survive. Returns the indices the server now holds.
+func (s *UploadService) restage(fu *models.FileUpload) ([]int, error) {
+	recorded, err := s.repo.GetChunksByFileID(fu.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load chunks: %w", err)
+	}
+	have, err := s.staging.Resume(fu.ID, recorded)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[int]bool, len(have))
+	for _, i := range have {
+		kept[i] = true
+	}
+	var stale []int
+	for _, ch := range recorded {
+		if !kept[ch.ChunkIndex] {
+			stale = append(stale, ch.ChunkIndex)
+		}
+	}
+	if len(stale) > 0 {
+		s.repo.DeleteChunks(fu.ID, stale...)
+	}
+	return have, nil
+}
+
+// Resume re-attaches an interrupted upload. The staged bytes are reconciled
+// against the recorded file_chunks rows and the verified indices are returned
+// so the client only sends what is missing.
+func (s *UploadService) Resume(uid, id uint) (*models.FileUpload, []int, error) {
+	fu, err := s.active(uid, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.restage(fu); err != nil {
+		slog.Error("upload resume: staging failed", "file_id", fu.ID, "err", err)
+		return nil, nil, utils.NewError(fiber.StatusInternalServerError, "resume failed")
+	}
+	uploaded, err := s.repo.GetVerifiedChunkIndices(fu.ID)
+	if err != nil {
+		slog.Error("upload resume: verify chunks failed", "file_id", fu.ID, "err", err)
+		return nil, nil, utils.NewError(fiber.StatusInternalServerError, "resume failed")
+	}
+
+	slog.Info("↻  upload resumed",
+		"file_id",   fu.ID,
+		"file_name", fu.FileName,
+		"have",      len(uploaded),
+		"total",     fu.TotalChunks,
+		"user",      uid,
+	)
+	return fu, uploaded, nil
+}
+
+// Suspend releases the in-memory staging state; the bytes stay on disk.
+func (s *UploadService) Suspend(id uint) { s.staging.Suspend(id) }
+
+// Complete checks that every chunk is present, verifies the whole-file
+// SHA-256 and hands the staged file to storage. Local storage finishes
+// synchronously ("completed"); S3 returns "processing" and finishes in the
+// background.
+func (s *UploadService) Complete(uid, id uint) (*models.FileUpload, error) {
+	fu, err := s.repo.GetByID(id)
+	if err != nil || (fu.UserID != uid && fu.UploaderID != uid) {
+		slog.Error("upload complete: not found or forbidden", "file_id", id, "user", uid)
+		return nil, utils.NewError(fiber.StatusNotFound, "not found or forbidden")
+	}
+	if err := s.Allowed(uid, fu); err != nil {
+		return nil, err
+	}
+	if fu.Status != "pending" && fu.Status != "uploading" {
+		return nil, utils.NewError(fiber.StatusConflict, "upload is "+fu.Status)
+	}
+	if fu.TotalChunks == 0 {
+		slog.Error("upload complete: no chunks staged", "file_id", id)
+		return nil, utils.NewError(fiber.StatusBadRequest, "no chunks")
+	}
+
+	staged, err := s.staging.Finish(id, fu.TotalChunks)
+	if errors.Is(err, ErrNotStaged) {
+		if _, err = s.restage(fu); err == nil {
+			staged, err = s.staging.Finish(id, fu.TotalChunks)
+		}
+	}
+	if err != nil {
+		slog.Error("upload complete: staging incomplete", "file_id", id, "err", err)
+		return nil, utils.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	s.repo.DeleteChunks(id)
+	if staged.Size != fu.FileSize {
+		// The quota was reserved for the declared size — hold clients to it
+		os.Remove(staged.Path)
+		s.abortMultipart(fu)
+		fu.Status = "failed"
+		s.repo.Update(fu)
+		return nil, utils.NewError(fiber.StatusBadRequest, fmt.Sprintf("size mismatch: got %d of %d bytes", staged.Size, fu.FileSize))
+	}
+	return s.finalize(fu, staged)
+}
+
+// finalize verifies the whole-file checksum — computed incrementally while the
+// bytes arrived — and hands the staged file to storage.
+func (s *UploadService) finalize(fu *models.FileUpload, staged *types.StagedFile) (*models.FileUpload, error) {
+	if staged.Checksum != fu.Checksum {
+		os.Remove(staged.Path)
+		s.abortMultipart(fu)
+		fu.Status = "failed"
+		s.repo.Update(fu)
+		slog.Error("upload complete: file checksum mismatch", "file_id", fu.ID, "file_name", fu.FileName)
+		return nil, utils.NewError(fiber.StatusUnprocessableEntity, "file checksum mismatch")
+	}
+
+	key := s.storageKey(fu)
+	if putter, ok := s.store.(types.IFilePutter); ok {
+		return s.finishDirect(fu, staged, key, putter)
+	}
+	return s.finishQueued(fu, staged, key)
+}
+
+// ─── Offset-addressed (tus) uploads ──────────────────────────────────────────
+
+// Offset returns the number of bytes staged for an unfinished upload,
+// reattaching the staging file if this process has not seen it yet.
+func (s *UploadService) Offset(uid, id uint) (*models.FileUpload, int64, error) {
+	fu, err := s.active(uid, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := s.staging.Reopen(id)
+	if err != nil {
+		slog.Error("upload offset: staging failed", "file_id", id, "err", err)
+		return nil, 0, utils.NewError(fiber.StatusInternalServerError, "staging unavailable")
+	}
+	return fu, size, nil
+}
+
+// Append streams bytes onto an upload at offset. If check is non-nil the
+// bytes must hash to want; on mismatch they are discarded and the error code
+// is 460 (tus "Checksum Mismatch").
+func (s *UploadService) Append(uid, id uint, offset int64, r io.Reader, check hash.Hash, want []byte) (int64, error) {
+	fu, err := s.active(uid, id)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := s.staging.Append(id, offset, r, check, want)
+	if errors.Is(err, ErrNotStaged) {
+		if _, err = s.staging.Reopen(id); err == nil {
+			size, err = s.staging.Append(id, offset, r, check, want)
+		}
+	}
+	switch {
+	case errors.Is(err, ErrOffsetMismatch):
+		return size, utils.NewError(fiber.StatusConflict, fmt.Sprintf("offset mismatch: server has %d bytes", size))
+	case errors.Is(err, ErrChecksumMismatch):
+		slog.Warn("upload append: checksum mismatch", "file_id", id, "offset", offset)
+		return size, utils.NewError(460, "checksum mismatch")
+	case err != nil:
+		slog.Error("upload append: staging write failed", "file_id", id, "offset", offset, "err", err)
+		return size, utils.NewError(fiber.StatusInternalServerError, "write failed")
+	}
+
+	if fu.Status != "uploading" {
+		if err := s.markUploading(fu, fu.TotalChunks); err != nil {
+			return size, err
+		}
+	} else {
+		s.touch(fu)
+	}
+	s.progress(fu)
+	return size, nil
+}
+
+// CompleteStream finalizes an offset-addressed upload once every declared
+// byte is staged. If the client never declared a whole-file checksum the one
+// computed while staging is recorded instead.
+func (s *UploadService) CompleteStream(uid, id uint) (*models.FileUpload, error) {
+	fu, err := s.active(uid, id)
+	if err != nil {
+		return nil, err
+	}
+
+	staged, err := s.staging.Finish(id, 0)
+	if errors.Is(err, ErrNotStaged) {
+		if _, err = s.staging.Reopen(id); err == nil {
+			staged, err = s.staging.Finish(id, 0)
+		}
+	}
+	if err != nil {
+		slog.Error("upload complete: staging failed", "file_id", id, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "staging unavailable")
+	}
+	if staged.Size != fu.FileSize {
+		os.Remove(staged.Path)
+		s.abortMultipart(fu)
+		fu.Status = "failed"
+		s.repo.Update(fu)
+		return nil, utils.NewError(fiber.StatusBadRequest, fmt.Sprintf("size mismatch: got %d of %d bytes", staged.Size, fu.FileSize))
+	}
+	if fu.Checksum == "" {
+		fu.Checksum = staged.Checksum
+	}
+	return s.finalize(fu, staged)
+}
+
+// Cancel aborts an unfinished upload and frees everything it staged.
+func (s *UploadService) Cancel(uid, id uint) error {
+	fu, err := s.active(uid, id)
+	if err != nil {
+		return err
+	}
+	if err := s.staging.Discard(id); err != nil {
+		slog.Warn("upload cancel: discard staging failed", "file_id", id, "err", err)
+	}
+	s.abortMultipart(fu)
+	if err := s.repo.Delete(fu.ID, uid); err != nil {
+		return utils.NewError(fiber.StatusInternalServerError, "delete failed")
+	}
+	slog.Info("✗  upload cancelled", "file_id", fu.ID, "file_name", fu.FileName, "user", uid)
+	return nil
+}
+
+// storeJob is the payload of a "store_upload" job.
+type storeJob struct {
+	StagedPath  string `json:"staged_path"`
+	Size        int64  `json:"size"`
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+}
+
+// finishQueued marks the file "processing" and queues a durable job that
+// pushes it to remote storage (S3).
+//
+// The caller replies to the client RIGHT NOW. The staged bytes stay on disk
+// until a worker has handed them to storage; failures are retried with
+// backoff, and a restart picks up where the previous process stopped. Once
+// the job finishes, the DB row is updated to "completed" and the next
+// file-list poll will show it normally.
+func (s *UploadService) finishQueued(fu *models.FileUpload, staged *types.StagedFile, key string) (*models.FileUpload, error) {
+	payload, _ := json.Marshal(storeJob{
+		StagedPath:  staged.Path,
+		Size:        staged.Size,
+		Key:         key,
+		ContentType: fu.FileType,
+	})
+	fu.Status = "processing"
+	s.repo.Update(fu)
+
+	fuID := fu.ID
+	job := &models.Job{UserID: fu.UserID, Kind: "store_upload", FileUploadID: &fuID, Payload: string(payload)}
+	if err := s.jobs.Enqueue(job); err != nil {
+		slog.Error("upload complete: enqueue failed", "file_id", fu.ID, "err", err)
+		fu.Status = "failed"
+		s.repo.Update(fu)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "queue failed")
+	}
+
+	slog.Info("⏳ queued for storage",
+		"file_id",   fu.ID,
+		"file_name", fu.FileName,
+		"file_size", staged.Size,
+		"storage",   s.store.Name(),
+		"job_id",    job.ID,
+	)
+	return fu, nil
+}
+
+// runStore streams a staged file to storage and marks the upload completed.
+// The staged file is only removed after storage has accepted it.
+func (s *UploadService) runStore(ctx context.Context, job *models.Job) error {
+	var p storeJob
+	if err := json.Unmarshal([]byte(job.Payload), &p); err != nil {
+		return fmt.Errorf("bad payload: %w", err)
+	}
+	start := time.Now()
+
+	record, err := s.repo.GetByID(*job.FileUploadID)
+	if err != nil {
+		return fmt.Errorf("db fetch: %w", err)
+	}
+
+	// Same content stored since this upload began — nothing to send
+	if b := s.blobs.Reuse(record.Checksum, p.Size); b != nil {
+		s.abortMultipart(record)
+		if err := s.link(record, b); err != nil {
+			s.unlink(record, err)
+			return fmt.Errorf("db update: %w", err)
+		}
+		os.Remove(p.StagedPath)
+		slog.Info("♻  upload deduplicated", "file_id", record.ID, "file_name", record.FileName, "blob_id", b.ID)
+		return nil
+	}
+
+	if err := s.transfer(ctx, record, p); err != nil {
+		slog.Error("✗  storage upload failed",
+			"file_id", job.FileUploadID,
+			"storage", s.store.Name(),
+			"key",     p.Key,
+			"attempt", job.Attempts,
+			"err",     err,
+			"elapsed", time.Since(start).Round(time.Millisecond),
+		)
+		return err
+	}
+
+	// Update DB: completed + point the file at its blob
+	b, err := s.blobs.Commit(ctx, record.Checksum, p.Size, p.Key)
+	if err != nil {
+		return err
+	}
+	if err := s.link(record, b); err != nil {
+		s.unlink(record, err)
+		return fmt.Errorf("db update: %w", err)
+	}
+	os.Remove(p.StagedPath)
+
+	// ✅ LOG: upload finished
+	slog.Info("✓  upload complete",
+		"file_id",   record.ID,
+		"file_name", record.FileName,
+		"storage",   s.store.Name(),
+		"key",       p.Key,
+		"elapsed",   time.Since(start).Round(time.Millisecond),
+	)
+	return nil
+}
+
+// link points an upload at the blob holding its bytes, completes it and
+// counts it against the owner's quota.
+func (s *UploadService) link(fu *models.FileUpload, b *models.Blob) error {
+	fu.BlobID      = &b.ID
+	fu.FilePath    = b.Key
+	fu.MultipartID = ""
+	fu.Status      = "completed"
+	if err := s.repo.Update(fu); err != nil {
+		return err
+	}
+	s.quota.Add(fu.UserID, fu.FileSize)
+	return nil
+}
+
+// unlink drops the blob reference taken for fu after link failed to record
+// it, so the blob's ref_count still matches the rows pointing at it. Bytes
+// nothing else references go with it. fu is left "failed" in memory.
+func (s *UploadService) unlink(fu *models.FileUpload, err error) {
+	slog.Error("upload: linking blob failed", "file_id", fu.ID, "blob_id", *fu.BlobID, "err", err)
+	if err := s.blobs.Release(context.Background(), fu); err != nil {
+		slog.Error("upload: releasing blob failed", "file_id", fu.ID, "blob_id", *fu.BlobID, "err", err)
+	}
+	fu.BlobID   = nil
+	fu.FilePath = ""
+	fu.Status   = "failed"
+}
+
+// transfer sends a staged file to storage — part by part when the upload has
+// a multipart upload (or is too big for one part), otherwise in a single Put.
+func (s *UploadService) transfer(ctx context.Context, record *models.FileUpload, p storeJob) error {
+	if s.mp != nil && record.MultipartID == "" && p.Size > s.mp.PartSize() {
+		uploadID, err := s.mp.Begin(ctx, p.Key, p.ContentType)
+		if err != nil {
+			return err
+		}
+		record.MultipartID  = uploadID
+		record.MultipartKey = p.Key
+		s.repo.Update(record)
+	}
+	if s.mp != nil && record.MultipartID != "" {
+		return s.mp.Complete(ctx, record.ID, record.MultipartKey, record.MultipartID, p.StagedPath, p.Size)
+	}
+
+	f, err := os.Open(p.StagedPath)
+	if err != nil {
+		return fmt.Errorf("open staged file: %w", err)
+	}
+	defer f.Close()
+	return s.store.Put(ctx, p.Key, f, p.Size, p.ContentType)
+}
+
+// giveUpStore marks the file failed once every retry is used up and aborts
+// its multipart upload, if any. The staged bytes are kept so the job can
+// still be retried by hand (a fresh multipart upload is started then).
+func (s *UploadService) giveUpStore(_ context.Context, job *models.Job) error {
+	record, err := s.repo.GetByID(*job.FileUploadID)
+	if err != nil {
+		return err
+	}
+	s.abortMultipart(record)
+	record.Status = "failed"
+	return s.repo.Update(record)
+}
+
+// linkFailed fails a direct upload whose row could not be pointed at its
+// blob. Its bytes are gone from staging by then, so it cannot be retried.
+func (s *UploadService) linkFailed(fu *models.FileUpload, err error) error {
+	s.unlink(fu, err)
+	fu.MultipartID = ""
+	if err := s.repo.Update(fu); err != nil {
+		slog.Error("upload complete: could not mark upload failed", "file_id", fu.ID, "err", err)
+	}
+	return utils.NewError(fiber.StatusInternalServerError, "write failed")
+}
+
+// finishDirect hands the staged file to a backend that can adopt it in place
+// (local disk: a rename) and completes the upload synchronously.
+func (s *UploadService) finishDirect(fu *models.FileUpload, staged *types.StagedFile, key string, putter types.IFilePutter) (*models.FileUpload, error) {
+	ctx := context.Background()
+	if b := s.blobs.Reuse(fu.Checksum, staged.Size); b != nil {
+		os.Remove(staged.Path)
+		if err := s.link(fu, b); err != nil {
+			return nil, s.linkFailed(fu, err)
+		}
+		slog.Info("♻  upload deduplicated", "file_id", fu.ID, "file_name", fu.FileName, "blob_id", b.ID)
+		return fu, nil
+	}
+
+	if err := putter.PutFile(ctx, key, staged.Path); err != nil {
+		os.Remove(staged.Path)
+		slog.Error("upload complete: write failed", "storage", s.store.Name(), "key", key, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "write failed")
+	}
+	b, err := s.blobs.Commit(ctx, fu.Checksum, staged.Size, key)
+	if err != nil {
+		s.store.Delete(ctx, key)
+		slog.Error("upload complete: blob commit failed", "file_id", fu.ID, "err", err)
+		return nil, utils.NewError(fiber.StatusInternalServerError, "write failed")
+	}
+	if err := s.link(fu, b); err != nil {
+		return nil, s.linkFailed(fu, err)
+	}
+
+	// ✅ LOG: upload finished
+	slog.Info("✓  upload complete",
+		"file_id",   fu.ID,
+		"file_name", fu.FileName,
+		"storage",   s.store.Name(),
+		"key",       key,
+		"size",      staged.Size,
+	)
+	return fu, nil
+}
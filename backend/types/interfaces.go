@@ -1,7 +1,12 @@
 package types
 
 import (
+	"context"
+	"errors"
 	"file-transfer-backend/models"
+	"hash"
+	"io"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
@@ -40,6 +45,9 @@ type IFolderHandler interface {
 	TrashFolder(c *fiber.Ctx) error
 	RestoreFolder(c *fiber.Ctx) error
 	DeleteFolder(c *fiber.Ctx) error
+	RenameFolder(c *fiber.Ctx) error
+	MoveFolder(c *fiber.Ctx) error
+	CopyFolder(c *fiber.Ctx) error
 }
 
 // ── Repositories ──────────────────────────────────────────
@@ -48,6 +56,8 @@ type IUserRepository interface {
 	FindByEmail(email string) (*models.User, error)
 	FindByID(id uint) (*models.User, error)
 	Update(u *models.User) error
+	AddUsage(id uint, delta int64) error
+	RecalculateUsage() error
 }
 
 type IFileRepository interface {
@@ -55,26 +65,195 @@ type IFileRepository interface {
 	GetByID(id uint) (*models.FileUpload, error)
 	Update(f *models.FileUpload) error
 	UpdateFolderID(id uint, folderID *uint) error
-	UpdateTrashed(id uint, trashed bool) error
+	Trash(id uint) error
+	Restore(id uint, folderID *uint, move bool) error
+	Rename(id, userID uint, name string, conflict NameConflict) (*Renamed, error)
+	// Copy and CopyTree check the copied size against the quota under a
+	// lock on the user, as CreateReserved does.
+	Copy(id, userID uint, folderID *uint, conflict NameConflict, limit func(quotaBytes int64) int64) (*Copy, error)
+	CompleteCopy(id uint, blob *models.Blob) (bool, error)
 	Delete(id, userID uint) error
+	DeleteFiles(userID uint, ids []uint) (*Deletion, error)
 	ListByFolder(userID uint, folderID *uint) ([]models.FileUpload, error)
+	ListInFolders(userID uint, folderIDs []uint) ([]models.FileUpload, error)
+	ListByIDs(userID uint, ids []uint) ([]models.FileUpload, error)
 	ListRecent(userID uint, limit int) ([]models.FileUpload, error)
 	ListStarred(userID uint) ([]models.FileUpload, error)
 	ListTrashed(userID uint) ([]models.FileUpload, error)
+	ListTrashedBefore(before time.Time) ([]models.FileUpload, error)
 	CreateChunk(ch *models.FileChunk) error
 	GetChunk(fileID uint, index int) (*models.FileChunk, error)
 	UpdateChunk(ch *models.FileChunk) error
+	MarkUploading(id uint, total int) (bool, error)
 	GetChunksByFileID(fileID uint) ([]models.FileChunk, error)
 	GetVerifiedChunkIndices(fileID uint) ([]int, error)
+	DeleteChunks(fileID uint, indices ...int) error
+	Touch(id uint) error
+	ExpireStale(before time.Time) ([]models.FileUpload, error)
+	PurgeDead(before time.Time) (map[uint]*Deletion, error)
+	DeleteOrphanChunks() (int64, error)
+	Unfinished(ids []uint) ([]uint, error)
+	InFlightBytes(userID uint) (int64, error)
+	// CreateReserved inserts an upload only if its declared size fits the
+	// owner's quota, which limit resolves from their own setting (-1 = none).
+	CreateReserved(f *models.FileUpload, limit func(quotaBytes int64) int64) error
+	UsageByUser(userID uint) (*Usage, error)
 }
 
 type IFolderRepository interface {
 	Create(f *models.Folder) error
 	GetByID(id, userID uint) (*models.Folder, error)
+	// Find loads a folder whoever owns it; callers check access first.
+	Find(id uint) (*models.Folder, error)
+	EnsurePath(userID uint, parentID *uint, names []string) (*uint, error)
 	ListByParent(userID uint, parentID *uint) ([]models.Folder, error)
 	ListTrashed(userID uint) ([]models.Folder, error)
-	UpdateTrashed(id, userID uint, trashed bool) error
-	Delete(id, userID uint) error
+	TrashTree(id, userID uint) error
+	RestoreTree(id, userID uint, parentID *uint, move bool) error
+	Rename(id, userID uint, name string, conflict NameConflict) (*Renamed, error)
+	Move(id, userID uint, parentID *uint, conflict NameConflict) (*Renamed, error)
+	CopyTree(id, userID uint, parentID *uint, conflict NameConflict, limit func(quotaBytes int64) int64) (*Copy, error)
+	Tree(id, userID uint) ([]models.Folder, error)
+	TreeSize(id, userID uint) (int64, error)
+	DeleteTree(id, userID uint) (*Deletion, error)
+	ListTrashedBefore(before time.Time) ([]models.Folder, error)
+}
+
+// ObjectRef names a stored object to remove. With UploadID set it is an
+// unfinished multipart upload at Key that must be aborted instead.
+type ObjectRef struct {
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id,omitempty"`
+	FileID   uint   `json:"file_id,omitempty"` // upload a multipart upload belongs to
+}
+
+// Deletion reports what a permanent delete removed.
+type Deletion struct {
+	Folders     int         `json:"folders"`
+	Files       int         `json:"files"`
+	Bytes       int64       `json:"bytes"`        // size of the completed files, returned to the quota
+	StoredBytes int64       `json:"stored_bytes"` // content no other file shares, removed from storage
+	Objects     []ObjectRef `json:"-"`
+}
+
+// NameConflict says what a rename does when a live sibling already has the
+// name: same folder, same kind (file or folder), not in the trash.
+type NameConflict string
+
+const (
+	ConflictFail    NameConflict = "fail"    // refuse with ErrNameTaken
+	ConflictRename  NameConflict = "rename"  // take the first free "name (n).ext"
+	ConflictReplace NameConflict = "replace" // move the sibling to the trash
+)
+
+// Role is what a user may do with a file or folder and everything below it.
+// Each role includes the ones before it; RoleOwner is never granted.
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"    // list, download, archive
+	RoleCommenter Role = "commenter" // as viewer; reserved for comments
+	RoleEditor    Role = "editor"    // rename, move, copy, create folders, trash
+	RoleOwner     Role = "owner"     // restore, delete, star, share
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleCommenter: 2, RoleEditor: 3, RoleOwner: 4}
+
+// Includes reports whether r allows everything need does. The empty role
+// includes nothing.
+func (r Role) Includes(need Role) bool { return roleRank[r] > 0 && roleRank[r] >= roleRank[need] }
+
+var (
+	ErrNameTaken   = errors.New("name already taken")
+	ErrFolderCycle = errors.New("folder cannot be moved into itself or a subfolder")
+)
+
+// QuotaExceeded is what IFileRepository.CreateReserved and the copy methods
+// return when the new files do not fit their owner's quota.
+type QuotaExceeded struct {
+	Used     int64 // used_bytes
+	InFlight int64 // declared size of the owner's unfinished uploads
+	Quota    int64
+}
+
+func (e *QuotaExceeded) Error() string { return "storage quota exceeded" }
+
+// Renamed reports the name an item ended up with and the siblings that were
+// trashed to make room for it.
+type Renamed struct {
+	Name     string
+	Replaced []uint
+}
+
+// Copy reports what a copy created. Deduplicated content is shared, not
+// copied; copies of files stored before dedup stay "processing" until a
+// "copy_objects" job (JobID) has copied their bytes.
+type Copy struct {
+	File    *models.FileUpload `json:"file,omitempty"`
+	Folder  *models.Folder     `json:"folder,omitempty"`
+	Folders int                `json:"folders"`
+	Files   int                `json:"files"`
+	Bytes   int64              `json:"bytes"`
+	JobID   *uint              `json:"job_id"`
+	Pending []CopyObject       `json:"-"`
+}
+
+// CopyObject is a file copy whose content still has to be copied from Src.
+type CopyObject struct {
+	FileID uint   `json:"file_id"`
+	Src    string `json:"src"`
+}
+
+type IJobRepository interface {
+	Create(j *models.Job) error
+	GetByID(id uint) (*models.Job, error)
+	Update(j *models.Job) error
+	ListByUser(userID uint, fileUploadID *uint, limit int) ([]models.Job, error)
+	// ClaimNext marks the next due job running under lease, a token only
+	// the claiming run knows.
+	ClaimNext(now time.Time, lease string) (*models.Job, error)
+	// Heartbeat renews the lease of a job its worker is still running. It
+	// reports false when the lease was lost to RequeueExpired.
+	Heartbeat(id uint, lease string, now time.Time) (bool, error)
+	// Finish writes the outcome of a run if it still holds the lease.
+	Finish(j *models.Job) (bool, error)
+	RequeueExpired(before time.Time) (int64, error)
+}
+
+type IBlobRepository interface {
+	Acquire(checksum string, size int64) (*models.Blob, error)
+	AcquireOwned(userID uint, checksum string, size int64) (*models.Blob, error)
+	CreateOrAcquire(b *models.Blob) (blob *models.Blob, created bool, err error)
+	Release(id uint) (blob *models.Blob, gone bool, err error)
+}
+
+type IShareRepository interface {
+	Create(l *models.ShareLink) error
+	GetByID(id uint) (*models.ShareLink, error)
+	GetByToken(token string) (*models.ShareLink, error)
+	ListByUser(userID uint, fileID, folderID *uint) ([]models.ShareLink, error)
+	Revoke(id uint, at time.Time) error
+	// CountDownload takes one download off a link's allowance. It reports
+	// false when the link was revoked, expired or used up meanwhile.
+	CountDownload(id uint, now time.Time) (bool, error)
+	LogAccess(a *models.ShareAccess) error
+	ListAccesses(linkID uint, limit int) ([]models.ShareAccess, error)
+}
+
+type IGrantRepository interface {
+	// Upsert creates a grant, or changes the role of the user's existing
+	// grant on the same item.
+	Upsert(g *models.Grant) error
+	GetByID(id uint) (*models.Grant, error)
+	Delete(id uint) error
+	// ListForItem returns the grants on one file or folder with each
+	// grantee's name and email.
+	ListForItem(fileID, folderID *uint) ([]GrantEntry, error)
+	// RolesOn returns the roles userID holds through grants on fileID (0 =
+	// none), on folderID or on any folder above it.
+	RolesOn(userID, fileID, folderID uint) ([]Role, error)
+	// SharedWith lists the live items granted to userID directly.
+	SharedWith(userID uint) (*SharedWithMe, error)
 }
 
 // ── Services ──────────────────────────────────────────────
@@ -92,4 +271,370 @@ type IChecksumService interface {
 type IFileService interface {
 	Reconstruct(fu *models.FileUpload, chunks []models.FileChunk, path string) error
 	VerifyFile(path, checksum string) (bool, error)
+}
+
+// JobFunc runs (or gives up on) one background job. Returning an error from a
+// run makes the queue retry with backoff until MaxAttempts is reached.
+type JobFunc func(ctx context.Context, job *models.Job) error
+
+type IJobQueue interface {
+	// Register binds a job kind to its runner. onGiveUp (optional) is called
+	// once when the last attempt has failed.
+	Register(kind string, run JobFunc, onGiveUp JobFunc)
+	Enqueue(job *models.Job) error
+	Retry(job *models.Job) error
+	Start(ctx context.Context)
+}
+
+// IBlobService keeps one stored copy per distinct content (SHA-256 + size)
+// and reference-counts it across FileUpload rows.
+type IBlobService interface {
+	// Key is where an upload's bytes go if they turn out to be new content.
+	Key(fu *models.FileUpload) string
+	// Reuse takes a reference on already-stored content, or returns nil.
+	// Only for bytes the server has received and hashed itself.
+	Reuse(checksum string, size int64) *models.Blob
+	// ReuseOwned is Reuse for a checksum the client merely claims: only
+	// content userID's own files already reference is handed out.
+	ReuseOwned(userID uint, checksum string, size int64) *models.Blob
+	// Commit records bytes just written at key. If the same content was
+	// stored meanwhile, that blob is referenced and the duplicate deleted.
+	Commit(ctx context.Context, checksum string, size int64, key string) (*models.Blob, error)
+	// Release drops a file's reference and deletes the bytes once unused.
+	Release(ctx context.Context, fu *models.FileUpload) error
+	// Purge queues removal of objects nothing references any more. The job
+	// retries with backoff until storage has deleted every one of them.
+	Purge(userID uint, objects []ObjectRef) error
+}
+
+// UsageBucket counts a group of a user's stored files.
+type UsageBucket struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Usage is a user's storage consumption against their quota.
+type Usage struct {
+	QuotaBytes     int64       `json:"quota_bytes"` // -1 = unlimited
+	UsedBytes      int64       `json:"used_bytes"`
+	InFlightBytes  int64       `json:"in_flight_bytes"` // unfinished uploads, reserved against the quota
+	AvailableBytes int64       `json:"available_bytes"` // -1 = unlimited
+	Active         UsageBucket `json:"active"`
+	Starred        UsageBucket `json:"starred"`
+	Trashed        UsageBucket `json:"trashed"`
+}
+
+type IQuotaService interface {
+	// Reserve fails with 413 when size more bytes would exceed the quota,
+	// counting unfinished uploads as already used. It only checks; nothing
+	// is held for the caller.
+	Reserve(userID uint, size int64) error
+	// CreateUpload inserts a new upload row, failing with 413 as Reserve
+	// does. The check and the insert happen under a lock on the owner, so
+	// parallel inits cannot share out the same free bytes.
+	CreateUpload(f *models.FileUpload) error
+	// Limit resolves a user's quota_bytes to their limit in bytes, -1 for
+	// none, for repositories that check it under a lock on the user.
+	Limit(quotaBytes int64) int64
+	// Exceeded turns the *QuotaExceeded of such a check into the 413 that
+	// Reserve gives; other errors are returned as they are.
+	Exceeded(err error, userID uint, size int64) error
+	Add(userID uint, delta int64)
+	Usage(userID uint) (*Usage, error)
+}
+
+// JanitorReport summarizes one cleanup run.
+type JanitorReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Expired    int       `json:"expired"`    // stale uploads marked expired
+	Purged     int64     `json:"purged"`     // failed/expired rows deleted after retention
+	ChunkRows  int64     `json:"chunk_rows"` // leftover file_chunks rows deleted
+	Staging    int       `json:"staging"`    // orphaned staging entries removed
+	Trash      Deletion  `json:"trash"`      // trash past its retention, deleted for good
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+type IJanitor interface {
+	Start(ctx context.Context)
+	Run(ctx context.Context) *JanitorReport
+	// LastRun is the most recent report, or nil before the first run.
+	LastRun() *JanitorReport
+}
+
+// ITrashService trashes and restores files and folders. Restoring with move
+// set puts the item into dest (nil = root) instead of where it was.
+type ITrashService interface {
+	TrashFile(uid, id uint) error
+	RestoreFile(uid, id uint, dest *uint, move bool) (*models.FileUpload, error)
+	TrashFolder(uid, id uint) error
+	RestoreFolder(uid, id uint, dest *uint, move bool) (*models.Folder, error)
+	// RestoreBatch restores folders first, then files, and reports per item.
+	RestoreBatch(uid uint, files, folders []uint, dest *uint, move bool) *TrashRestore
+	// Empty permanently deletes everything in a user's trash.
+	Empty(uid uint) (*Deletion, error)
+	// PurgeExpired permanently deletes, for all users, what was trashed
+	// before the given time.
+	PurgeExpired(before time.Time) (*Deletion, error)
+}
+
+// TrashRestore is the outcome of a batch restore.
+type TrashRestore struct {
+	Files   []models.FileUpload `json:"files"`
+	Folders []models.Folder     `json:"folders"`
+	Failed  []TrashFailure      `json:"failed"`
+}
+
+type TrashFailure struct {
+	Kind  string `json:"kind"` // "file" or "folder"
+	ID    uint   `json:"id"`
+	Error string `json:"error"`
+}
+
+type ICopyService interface {
+	// With elsewhere false the copy goes next to the original; otherwise
+	// into dest (nil = root).
+	CopyFile(uid, id uint, dest *uint, elsewhere bool, conflict NameConflict) (*Copy, error)
+	CopyFolder(uid, id uint, dest *uint, elsewhere bool, conflict NameConflict) (*Copy, error)
+}
+
+// ArchiveEntry is one entry of a ZIP download: a file at Path, or with File
+// nil a directory (kept so empty folders survive).
+type ArchiveEntry struct {
+	Path string
+	File *models.FileUpload
+}
+
+type IArchiveService interface {
+	// Folder lists a folder's live contents below a directory named after it.
+	Folder(uid, id uint) (name string, entries []ArchiveEntry, err error)
+	// Files lists the given files, each at the directory of its RelPath.
+	Files(uid uint, ids []uint) ([]ArchiveEntry, error)
+	// Write streams entries as a ZIP with method zip.Store or zip.Deflate.
+	Write(ctx context.Context, w io.Writer, entries []ArchiveEntry, method uint16) error
+}
+
+// ShareCreate is what a user asks for when creating a share link. Exactly
+// one of FileID / FolderID must be set.
+type ShareCreate struct {
+	FileID       *uint      `json:"file_id"`
+	FolderID     *uint      `json:"folder_id"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Password     string     `json:"password"`
+	MaxDownloads int        `json:"max_downloads"` // 0 = unlimited
+}
+
+// ShareVisit describes one request made with a share link.
+type ShareVisit struct {
+	Token     string
+	Password  string
+	Download  bool // fetches content; recorded (and maybe counted) by Served
+	IP        string
+	UserAgent string
+}
+
+// SharedItem is what a share link opened to: a file, or a folder's archive
+// entries.
+type SharedItem struct {
+	Link    *models.ShareLink
+	Name    string
+	File    *models.FileUpload
+	Entries []ArchiveEntry
+}
+
+type IShareService interface {
+	Create(uid uint, req ShareCreate) (*models.ShareLink, error)
+	// List returns the user's links, optionally only those for one file or folder.
+	List(uid uint, fileID, folderID *uint) ([]models.ShareLink, error)
+	Revoke(uid, id uint) error
+	Accesses(uid, id uint) ([]models.ShareAccess, error)
+	// Open checks a visit against its link. Visits that don't fetch content
+	// are recorded here; downloads are recorded by Served.
+	Open(v ShareVisit) (*SharedItem, error)
+	// Served records a download that passed Open with its outcome. Only a
+	// "download" — the whole item, or a range from its first byte — counts
+	// against the link's allowance; it fails with 410 once that is used up.
+	Served(item *SharedItem, v ShareVisit, outcome string) error
+}
+
+// GrantEntry is a grant with its grantee.
+type GrantEntry struct {
+	models.Grant `gorm:"embedded"`
+	Email        string `json:"email"`
+	Name         string `json:"name"`
+}
+
+// SharedFile and SharedFolder are items granted to a user, with the role
+// and who owns them.
+type SharedFile struct {
+	models.FileUpload `gorm:"embedded"`
+	GrantID           uint   `json:"grant_id"`
+	Role              Role   `json:"role"`
+	OwnerName         string `json:"owner_name"`
+	OwnerEmail        string `json:"owner_email"`
+}
+
+type SharedFolder struct {
+	models.Folder `gorm:"embedded"`
+	GrantID       uint   `json:"grant_id"`
+	Role          Role   `json:"role"`
+	OwnerName     string `json:"owner_name"`
+	OwnerEmail    string `json:"owner_email"`
+}
+
+type SharedWithMe struct {
+	Files   []SharedFile   `json:"files"`
+	Folders []SharedFolder `json:"folders"`
+}
+
+// IPermissionService decides what a user may do with files and folders they
+// don't own. Every file and folder handler loads its item through File or
+// Folder; the work itself then runs against the owner's drive (UserID of
+// the returned row), so quotas and names stay the owner's.
+type IPermissionService interface {
+	// File loads a file uid holds at least need on: 404 when it doesn't
+	// exist, 403 when uid lacks the role. Items in the trash are the
+	// owner's alone.
+	File(uid, id uint, need Role) (*models.FileUpload, error)
+	Folder(uid, id uint, need Role) (*models.Folder, error)
+	// Destination checks that uid may put items of owner's drive into
+	// folderID; nil is the owner's top level, which only the owner may use.
+	Destination(uid, owner uint, field string, folderID *uint) error
+
+	// Grants lists the grants on an item the caller owns (one of fileID /
+	// folderID set).
+	Grants(uid uint, fileID, folderID *uint) ([]GrantEntry, error)
+	// Grant gives the user with email a role on an item the caller owns,
+	// replacing the role they had on it.
+	Grant(uid uint, fileID, folderID *uint, email string, role Role) (*GrantEntry, error)
+	// Revoke removes a grant; its owner or its grantee may do so.
+	Revoke(uid, id uint) error
+	SharedWithMe(uid uint) (*SharedWithMe, error)
+}
+
+// UploadInit is what a client declares before sending chunks.
+type UploadInit struct {
+	FileName    string
+	FileType    string
+	FileSize    int64
+	Checksum    string // SHA-256 hex of the whole file
+	RelPath     string
+	FolderID    *uint
+	TotalChunks int // optional; may also be announced with each chunk
+}
+
+type IUploadService interface {
+	Init(uid uint, req UploadInit) (*models.FileUpload, error)
+	WriteChunk(uid, id uint, index, total int, checksum string, data []byte) (received, totalChunks int, err error)
+	Resume(uid, id uint) (*models.FileUpload, []int, error)
+	Suspend(id uint)
+	Complete(uid, id uint) (*models.FileUpload, error)
+	Allowed(uid uint, fu *models.FileUpload) error
+
+	// Offset-addressed (tus) uploads
+	Offset(uid, id uint) (*models.FileUpload, int64, error)
+	Append(uid, id uint, offset int64, r io.Reader, check hash.Hash, want []byte) (int64, error)
+	CompleteStream(uid, id uint) (*models.FileUpload, error)
+	Cancel(uid, id uint) error
+}
+
+// StagedFile is a fully received upload sitting in the staging area.
+type StagedFile struct {
+	Path     string
+	Size     int64
+	Checksum string // SHA-256 hex of the assembled bytes
+}
+
+type IStagingService interface {
+	Begin(id uint) error
+	WriteChunk(id uint, index int, data []byte) (received int, err error)
+	Finish(id uint, total int) (*StagedFile, error)
+	Resume(id uint, recorded []models.FileChunk) ([]int, error)
+	Append(id uint, offset int64, r io.Reader, check hash.Hash, want []byte) (int64, error)
+	Reopen(id uint) (int64, error)
+	// Path and Size expose the contiguous staged prefix so it can be streamed
+	// onward (multipart parts) while the upload is still in progress.
+	Path(id uint) string
+	Size(id uint) (int64, error)
+	Suspend(id uint)
+	Discard(id uint) error
+	// List returns the ids of every upload with anything staged on disk.
+	List() ([]uint, error)
+}
+
+// ── Storage ───────────────────────────────────────────────
+
+// ObjectInfo describes one stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// IStorage is where finished files live. Keys are slash-separated paths such
+// as "users/42/folders/7/report.pdf"; FileUpload.FilePath holds the key.
+type IStorage interface {
+	// Name identifies the backend in logs ("local", "s3", "memory").
+	Name() string
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// Presign returns a short-lived URL the client can download from directly,
+	// or "" when the backend cannot issue one and the server must stream it.
+	Presign(ctx context.Context, key, fileName string, ttl time.Duration) (string, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// IFilePutter is implemented by backends that can take over a file already on
+// the server's disk without re-reading it over the network. Uploads into such
+// backends are finalized synchronously; all others go through the job queue.
+type IFilePutter interface {
+	PutFile(ctx context.Context, key, path string) error
+}
+
+// IObjectCopier is implemented by backends that copy an object in place
+// (S3 CopyObject, a file copy on disk) instead of streaming it through the
+// server.
+type IObjectCopier interface {
+	Copy(ctx context.Context, src, dst string) error
+}
+
+// IRangeReader is implemented by backends that can open part of an object
+// (S3 ranged GET, a seek on disk) instead of reading it from the start.
+type IRangeReader interface {
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// StoredPart is one part of an unfinished multipart upload.
+type StoredPart struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// IMultipartStorage is implemented by backends that accept an object in
+// parts (S3). Parts may be uploaded in any order and re-uploaded; every part
+// except the last must be at least the backend's minimum size.
+type IMultipartStorage interface {
+	CreateMultipart(ctx context.Context, key, contentType string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (etag string, err error)
+	ListParts(ctx context.Context, key, uploadID string) ([]StoredPart, error)
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []StoredPart) error
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
+
+// IMultipartUploader streams a staged upload to multipart storage part by
+// part while chunks are still arriving.
+type IMultipartUploader interface {
+	// PartSize is the byte size of every part but the last.
+	PartSize() int64
+	Begin(ctx context.Context, key, contentType string) (uploadID string, err error)
+	// Progress schedules every whole part inside the first `size` staged bytes
+	// that has not been sent yet. It never blocks on the network.
+	Progress(fileID uint, key, uploadID, path string, size int64)
+	// Complete waits for in-flight parts, uploads whatever is still missing
+	// from the staged file at path, and assembles the object.
+	Complete(ctx context.Context, fileID uint, key, uploadID, path string, size int64) error
+	Abort(ctx context.Context, fileID uint, key, uploadID string)
 }
\ No newline at end of file
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ── Content-Disposition ───────────────────────────────────
+//
+// File names are UTF-8 and may hold anything CleanFileName lets through —
+// quotes, backslashes, Cyrillic, Georgian — and rows older than that
+// normalization may hold worse. ContentDisposition is the only place a name
+// goes into a header (RFC 6266): filename= gets an ASCII fallback for old
+// clients, filename*= the real name percent-encoded (RFC 8187, which
+// replaced RFC 5987). Clients that understand filename* prefer it.
+
+// ContentDisposition returns a Content-Disposition value; disposition is
+// "attachment" or "inline".
+func ContentDisposition(disposition, name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(name, "�"))
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "download"
+	}
+	return disposition + `; filename="` + asciiFallback(name) + `"; filename*=UTF-8''` + encodeExtValue(name)
+}
+
+// asciiFallback replaces every run of characters that are not safe inside a
+// quoted-string in every browser (non-ASCII, '"', '\', '%') with one "_".
+// A name left with nothing readable before its extension becomes
+// "download.<ext>".
+func asciiFallback(name string) string {
+	var b strings.Builder
+	replaced := false
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			if !replaced {
+				b.WriteByte('_')
+			}
+			replaced = true
+			continue
+		}
+		replaced = false
+		b.WriteRune(r)
+	}
+	out := b.String()
+
+	ext  := path.Ext(out)
+	stem := strings.TrimSuffix(out, ext)
+	if strings.Trim(stem, "_ .") == "" {
+		if strings.Trim(ext, "_.") == "" {
+			ext = ""
+		}
+		return "download" + ext
+	}
+	return out
+}
+
+// encodeExtValue percent-encodes the UTF-8 bytes of s, leaving only RFC 8187
+// attr-chars as they are.
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < utf8.RuneSelf && isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
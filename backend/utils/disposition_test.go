@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition string
+		in          string
+		fallback    string
+		ext         string
+	}{
+		{"ascii", "attachment", "report.pdf", "report.pdf", "report.pdf"},
+		{"inline", "inline", "a.png", "a.png", "a.png"},
+		{"spaces", "attachment", "my report.pdf", "my report.pdf", "my%20report.pdf"},
+		{"trimmed", "attachment", "  x.txt  ", "x.txt", "x.txt"},
+		{"attr chars kept", "attachment", "a+b=c.txt", "a+b=c.txt", "a+b%3Dc.txt"},
+		{"quotes", "attachment", `a "b".txt`, "a _b_.txt", "a%20%22b%22.txt"},
+		{"backslash and percent", "attachment", `back\slash%.txt`, "back_slash_.txt", "back%5Cslash%25.txt"},
+		{"mixed script", "attachment", "mixed Ωmega.txt", "mixed _mega.txt", "mixed%20%CE%A9mega.txt"},
+		{"cyrillic", "attachment", "отчёт.pdf", "download.pdf", "%D0%BE%D1%82%D1%87%D1%91%D1%82.pdf"},
+		{"no ascii at all", "attachment", "日本", "download", "%E6%97%A5%E6%9C%AC"},
+		{"only dots", "attachment", "...", "download", "..."},
+		{"control bytes dropped", "attachment", "a\r\nb.txt", "ab.txt", "ab.txt"},
+		{"invalid utf-8", "attachment", "a\xffb.txt", "a_b.txt", "a%EF%BF%BDb.txt"},
+		{"empty", "attachment", "", "download", "download"},
+		{"only controls", "attachment", "\x00\n", "download", "download"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.disposition + `; filename="` + tt.fallback + `"; filename*=UTF-8''` + tt.ext
+			if got := ContentDisposition(tt.disposition, tt.in); got != want {
+				t.Fatalf("%q:\n got  %s\n want %s", tt.in, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ── Client-supplied names ─────────────────────────────────
+//
+// File names and relative paths come straight from the client and end up in
+// storage keys, folder trees and Content-Disposition headers. They are
+// normalized once, at upload init, so nothing downstream has to distrust
+// them:
+//
+//	- no NUL or other control characters
+//	- no absolute paths ("/x", "\x", "C:x") and no ".." segments
+//	- "\" is treated as a separator in paths; "." and empty segments drop out
+//	- no Windows device names (CON, NUL, COM1, LPT1.txt, …)
+//	- at most MaxNameBytes per segment and MaxPathBytes per path
+
+const (
+	MaxNameBytes = 255
+	MaxPathBytes = 4096
+)
+
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// CleanFileName validates a single file or folder name and returns it with
+// surrounding whitespace trimmed.
+func CleanFileName(field, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", NewFieldError(fiber.StatusBadRequest, field, field+" is required")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return "", NewFieldError(fiber.StatusBadRequest, field, field+" must not contain path separators")
+	}
+	if err := checkSegment(field, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// CleanRelPath normalizes a relative path such as "photos/2024/a.jpg" to
+// slash-separated form. An empty path stays empty.
+func CleanRelPath(field, p string) (string, error) {
+	if strings.TrimSpace(p) == "" {
+		return "", nil
+	}
+	if len(p) > MaxPathBytes {
+		return "", NewFieldError(fiber.StatusBadRequest, field, fmt.Sprintf("%s is longer than %d bytes", field, MaxPathBytes))
+	}
+	p = strings.ReplaceAll(p, `\`, "/")
+	if strings.HasPrefix(p, "/") || hasDrive(p) {
+		return "", NewFieldError(fiber.StatusBadRequest, field, field+" must be relative")
+	}
+
+	var parts []string
+	for _, seg := range strings.Split(p, "/") {
+		seg = strings.TrimSpace(seg)
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			return "", NewFieldError(fiber.StatusBadRequest, field, field+` must not contain ".."`)
+		}
+		if err := checkSegment(field, seg); err != nil {
+			return "", err
+		}
+		parts = append(parts, seg)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+func checkSegment(field, seg string) error {
+	if len(seg) > MaxNameBytes {
+		return NewFieldError(fiber.StatusBadRequest, field, fmt.Sprintf("%s has a name longer than %d bytes", field, MaxNameBytes))
+	}
+	for _, r := range seg {
+		if r < 0x20 || r == 0x7f {
+			return NewFieldError(fiber.StatusBadRequest, field, field+" must not contain control characters")
+		}
+	}
+	if seg == "." || seg == ".." {
+		return NewFieldError(fiber.StatusBadRequest, field, fmt.Sprintf("%s must not be %q", field, seg))
+	}
+	// Windows resolves "NUL.txt" and "con " to the device as well
+	base, _, _ := strings.Cut(seg, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return NewFieldError(fiber.StatusBadRequest, field, fmt.Sprintf("%s uses the reserved name %q", field, base))
+	}
+	return nil
+}
+
+// hasDrive reports a Windows drive prefix such as "C:".
+func hasDrive(p string) bool {
+	return len(p) >= 2 && p[1] == ':' &&
+		(p[0] >= 'a' && p[0] <= 'z' || p[0] >= 'A' && p[0] <= 'Z')
+}
+
+// ─── Numbered copies ──────────────────────────────────────────────────────────
+
+// SplitNumbered splits a name into the stem that numbered variants share and
+// the extension kept after the number: "report (2).pdf" → "report", ".pdf".
+// Folders (ext false) and dotfiles such as ".env" have no extension.
+func SplitNumbered(name string, ext bool) (stem, extension string) {
+	stem = name
+	if ext {
+		if i := strings.LastIndex(name, "."); i > 0 {
+			stem, extension = name[:i], name[i:]
+		}
+	}
+	if i := strings.LastIndex(stem, " ("); i > 0 && strings.HasSuffix(stem, ")") {
+		if _, err := strconv.Atoi(stem[i+2 : len(stem)-1]); err == nil {
+			stem = stem[:i]
+		}
+	}
+	return stem, extension
+}
+
+// NumberedName returns "stem (n)ext", shortening the stem on a rune boundary
+// when the result would exceed MaxNameBytes.
+func NumberedName(stem, extension string, n int) string {
+	suffix := fmt.Sprintf(" (%d)%s", n, extension)
+	for len(stem)+len(suffix) > MaxNameBytes && stem != "" {
+		_, size := utf8.DecodeLastRuneInString(stem)
+		stem = stem[:len(stem)-size]
+	}
+	return stem + suffix
+}
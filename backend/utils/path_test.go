@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCleanFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		ok   bool
+	}{
+		{"plain", "report.pdf", "report.pdf", true},
+		{"unicode", "отчёт 2024.pdf", "отчёт 2024.pdf", true},
+		{"dotfile", ".env", ".env", true},
+		{"trimmed", "  notes.txt ", "notes.txt", true},
+		{"reserved lookalike", "console.log", "console.log", true},
+		{"max length", strings.Repeat("a", MaxNameBytes), strings.Repeat("a", MaxNameBytes), true},
+
+		{"empty", "", "", false},
+		{"blank", "   ", "", false},
+		{"slash", "a/b.txt", "", false},
+		{"backslash", `a\b.txt`, "", false},
+		{"absolute", "/etc/x", "", false},
+		{"unc", `\\srv\x`, "", false},
+		{"dot", ".", "", false},
+		{"dotdot", "..", "", false},
+		{"nul byte", "a\x00.txt", "", false},
+		{"newline", "a\nb.txt", "", false},
+		{"escape", "a\x1b[31m.txt", "", false},
+		{"del", "a\x7f.txt", "", false},
+		{"device", "CON", "", false},
+		{"device lower with ext", "nul.txt", "", false},
+		{"device trailing space", "LPT1 ", "", false},
+		{"device with space before ext", "com3 .log", "", false},
+		{"overlong", strings.Repeat("a", MaxNameBytes+1), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CleanFileName("file_name", tt.in)
+			checkClean(t, tt.in, got, err, tt.want, tt.ok, "file_name")
+		})
+	}
+}
+
+func TestCleanRelPath(t *testing.T) {
+	long := strings.Repeat(strings.Repeat("d", 100)+"/", MaxPathBytes/101+1)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+		ok   bool
+	}{
+		{"empty", "", "", true},
+		{"blank", "  ", "", true},
+		{"single", "a.jpg", "a.jpg", true},
+		{"nested", "photos/2024/a.jpg", "photos/2024/a.jpg", true},
+		{"backslashes", `photos\2024\a.jpg`, "photos/2024/a.jpg", true},
+		{"mixed separators", `photos/2024\a.jpg`, "photos/2024/a.jpg", true},
+		{"dot and empty segments", "./photos//2024/./a.jpg/", "photos/2024/a.jpg", true},
+		{"trimmed segments", " photos / a.jpg ", "photos/a.jpg", true},
+		{"dots inside names", "v1..2/a..b.txt", "v1..2/a..b.txt", true},
+
+		{"absolute", "/etc/x", "", false},
+		{"absolute backslash", `\etc\x`, "", false},
+		{"unc", `\\srv\x`, "", false},
+		{"drive", "C:x", "", false},
+		{"drive with separator", `c:\Windows\x`, "", false},
+		{"dotdot", "..", "", false},
+		{"dotdot escape", "a/../../b", "", false},
+		{"dotdot backslash", `a\..\..\b`, "", false},
+		{"dotdot in middle", "a/../b", "", false},
+		{"nul byte", "a/b\x00.txt", "", false},
+		{"control byte", "a/\x01b", "", false},
+		{"device segment", "docs/CON/a.txt", "", false},
+		{"device file", "docs/nul.txt", "", false},
+		{"device trailing space", "LPT1 /a.txt", "", false},
+		{"overlong segment", "a/" + strings.Repeat("b", MaxNameBytes+1), "", false},
+		{"overlong path", long, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CleanRelPath("rel_path", tt.in)
+			checkClean(t, tt.in, got, err, tt.want, tt.ok, "rel_path")
+		})
+	}
+}
+
+func checkClean(t *testing.T, in, got string, err error, want string, ok bool, field string) {
+	t.Helper()
+	if !ok {
+		var ae *AppError
+		if !errors.As(err, &ae) {
+			t.Fatalf("%q: want a validation error, got %q, %v", in, got, err)
+		}
+		if ae.Code != 400 || ae.Field != field {
+			t.Fatalf("%q: want a 400 on %s, got %d on %q", in, field, ae.Code, ae.Field)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("%q: unexpected error: %v", in, err)
+	}
+	if got != want {
+		t.Fatalf("%q: got %q, want %q", in, got, want)
+	}
+}
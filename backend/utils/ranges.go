@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ── Byte ranges ───────────────────────────────────────────
+//
+// Range requests (RFC 9110 §14) for downloads. A header that does not parse
+// is ignored and the whole body is sent, as the RFC allows; a header that
+// parses but names nothing inside the body is answered with 416.
+
+// MaxRanges is how many ranges one request may ask for. Past that the Range
+// header is ignored — a long list of tiny or overlapping ranges costs far
+// more to serve than the whole file.
+const MaxRanges = 16
+
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ByteRange is Length bytes starting at Start.
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats r as a Content-Range value for a body of size bytes.
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header against a body of size bytes. It returns
+// no ranges (and no error) when the header should be ignored, and
+// ErrRangeNotSatisfiable when none of the ranges overlaps the body.
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	unit, set, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, nil
+	}
+
+	var ranges []ByteRange
+	specs := 0
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if specs++; specs > MaxRanges {
+			return nil, nil
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, nil
+		}
+
+		// "-n": the last n bytes
+		if first == "" {
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, ByteRange{Start: size - n, Length: n})
+			continue
+		}
+
+		// "a-" or "a-b"
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, nil
+		}
+		end := size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return nil, nil
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+	}
+
+	if specs == 0 {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, ErrRangeNotSatisfiable
+	}
+	return ranges, nil
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	many := "bytes=" + strings.TrimSuffix(strings.Repeat("0-0,", MaxRanges+1), ",")
+
+	tests := []struct {
+		name   string
+		header string
+		size   int64
+		want   []ByteRange
+		err    error
+	}{
+		{"first bytes", "bytes=0-9", 100, []ByteRange{{0, 10}}, nil},
+		{"open end", "bytes=10-", 100, []ByteRange{{10, 90}}, nil},
+		{"suffix", "bytes=-10", 100, []ByteRange{{90, 10}}, nil},
+		{"suffix longer than body", "bytes=-200", 100, []ByteRange{{0, 100}}, nil},
+		{"end clamped", "bytes=90-200", 100, []ByteRange{{90, 10}}, nil},
+		{"single byte", "bytes=99-99", 100, []ByteRange{{99, 1}}, nil},
+		{"several", "bytes=0-0, -1", 100, []ByteRange{{0, 1}, {99, 1}}, nil},
+		{"unit case and spaces", "BYTES =0-1", 100, []ByteRange{{0, 2}}, nil},
+		{"unsatisfiable one dropped", "bytes=0-1,500-600", 100, []ByteRange{{0, 2}}, nil},
+		{"max ranges", "bytes=" + strings.TrimSuffix(strings.Repeat("0-0,", MaxRanges), ","), 100, slices.Repeat([]ByteRange{{0, 1}}, MaxRanges), nil},
+
+		// Ignored: the whole body is sent
+		{"empty", "", 100, nil, nil},
+		{"other unit", "items=0-1", 100, nil, nil},
+		{"no specs", "bytes=", 100, nil, nil},
+		{"no dash", "bytes=abc", 100, nil, nil},
+		{"end before start", "bytes=5-1", 100, nil, nil},
+		{"bad suffix", "bytes=-x", 100, nil, nil},
+		{"negative start", "bytes=-1-5", 100, nil, nil},
+		{"bad range among good", "bytes=0-1,x-2", 100, nil, nil},
+		{"too many ranges", many, 100, nil, nil},
+
+		// 416
+		{"start at size", "bytes=100-", 100, nil, ErrRangeNotSatisfiable},
+		{"start past size", "bytes=200-300", 100, nil, ErrRangeNotSatisfiable},
+		{"zero suffix", "bytes=-0", 100, nil, ErrRangeNotSatisfiable},
+		{"empty body", "bytes=0-", 0, nil, ErrRangeNotSatisfiable},
+		{"suffix of empty body", "bytes=-5", 0, nil, ErrRangeNotSatisfiable},
+		{"all outside", "bytes=100-101,150-", 100, nil, ErrRangeNotSatisfiable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRange(tt.header, tt.size)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("%q: err %v, want %v", tt.header, err, tt.err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("%q: got %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentRange(t *testing.T) {
+	if got := (ByteRange{Start: 90, Length: 10}).ContentRange(100); got != "bytes 90-99/100" {
+		t.Fatalf("got %q", got)
+	}
+	if got := (ByteRange{Start: 0, Length: 1}).ContentRange(1); got != "bytes 0-0/1" {
+		t.Fatalf("got %q", got)
+	}
+}